@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var browseCmd = &cobra.Command{
+	Use:   "browse [path]",
+	Short: "Browse the KV tree in a terminal UI and export selected keys",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(ccmd *cobra.Command, args []string) {
+		path := ""
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Browse(ctx, path)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(browseCmd)
+}
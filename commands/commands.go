@@ -1,8 +1,11 @@
 package commands
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"consulenv/consul"
 	"path/filepath"
@@ -36,31 +39,266 @@ func init() {
 
 	Cmd.PersistentFlags().StringP("addr", "", "127.0.0.1:8500", "Consul server address")
 	Cmd.PersistentFlags().StringP("token", "", "", "Consul token")
-	Cmd.PersistentFlags().StringP("auth", "", "", "Consul server API user:pass")
+	Cmd.PersistentFlags().StringP("auth", "", "", "Consul server API user:pass (insecure, visible in process list)")
+	Cmd.PersistentFlags().StringP("auth-user", "", "", "Consul server API user, password is prompted or read from --auth-password-file")
+	Cmd.PersistentFlags().StringP("auth-password-file", "", "", "File to read Consul API password from, - for stdin")
 	Cmd.PersistentFlags().StringP("ssl", "", "false", "Consul server HTTPS")
 
+	Cmd.PersistentFlags().StringSliceP("cluster", "", nil, "Fetch the paths from each of these clusters, name=addr, and label the output by cluster")
+	Cmd.PersistentFlags().StringP("fallback-token", "", "", "Token to retry a path or key with when the primary token is denied access, not with --consistent")
+	Cmd.PersistentFlags().StringSliceP("path-token", "", nil, "Token for paths under a prefix, prefix=token")
+	Cmd.PersistentFlags().StringP("datacenter", "", "", "Consul datacenter, paths can override it with a dc=NAME: prefix")
+	Cmd.PersistentFlags().StringP("namespace", "", "", "Consul namespace, paths can override it with a ns=NAME: prefix")
+	Cmd.PersistentFlags().BoolP("validate-token", "", false, "Check the ACL token before querying")
+
 	Cmd.PersistentFlags().MarkHidden("addr")
 	Cmd.PersistentFlags().MarkHidden("token")
 	Cmd.PersistentFlags().MarkHidden("auth")
 	Cmd.PersistentFlags().MarkHidden("ssl")
 
-	Cmd.PersistentFlags().StringSliceP("path", "p", nil, "Path")
+	Cmd.PersistentFlags().StringSliceP("path", "p", nil, "Path, optionally qualified as dc=NAME,ns=NAME:path")
+	Cmd.PersistentFlags().StringP("cache-file", "", "", "Cache listings here and only re-download paths whose Consul index changed")
+	Cmd.PersistentFlags().StringP("cache-dir", "", "", "Save a snapshot of every listed path here, per Consul address, for --offline")
+	Cmd.PersistentFlags().BoolP("offline", "", false, "Read paths from the --cache-dir snapshots of the same address instead of Consul")
+	Cmd.PersistentFlags().StringP("prefix", "", "", "Root prepended to every path, e.g. teams/payments")
+	Cmd.PersistentFlags().BoolP("consistent", "", false, "Read all paths in one transaction for a consistent snapshot")
+	Cmd.PersistentFlags().BoolP("with-descriptions", "", false, "Render <key>.desc sidecar keys as comments above their variable")
+	Cmd.PersistentFlags().StringP("key-separator", "", "/", "Separator between folders and variable name in Consul keys")
+	Cmd.PersistentFlags().StringSliceP("flags-filter", "", nil, "Only output keys whose Consul KV flags equal one of these values")
+	Cmd.PersistentFlags().Uint64P("modified-since-index", "", 0, "Only output keys with a ModifyIndex above N, and print the highest index seen")
+	Cmd.PersistentFlags().StringP("state-file", "", "", "Remember the highest ModifyIndex here and only output later changes on the next run or --poll cycle")
+	Cmd.PersistentFlags().StringSliceP("exclude-path", "", nil, "Skip Consul keys under this path prefix or glob")
+	Cmd.PersistentFlags().StringP("service", "", "", "Service name to compose the default paths from, when no --path is given")
+	Cmd.PersistentFlags().StringP("env", "", "", "Environment to compose the default paths from, used with --service")
+	Cmd.PersistentFlags().StringP("service-path-template", "", "apps/{{.service}}/{{.env}}", "Path composed from --service and --env")
+	Cmd.PersistentFlags().StringArrayP("service-base-template", "", nil, "Shared lower precedence path composed from --service, e.g. apps/{{.service}}/common")
+	Cmd.PersistentFlags().StringP("path-template", "", "", "Extra path built from a template with {{.Dir}}, {{.Branch}} and {{.Env \"VAR\"}}")
 	Cmd.PersistentFlags().BoolP("export", "e", false, "Export bash format")
+	Cmd.PersistentFlags().StringP("bash-array", "", "", "Also declare a bash array with this name listing the loaded variable names, env and export formats only")
 	Cmd.PersistentFlags().BoolP("json", "j", false, "Return in JSON format")
+	Cmd.PersistentFlags().BoolP("json-pretty", "", false, "Indent JSON output")
+	Cmd.PersistentFlags().IntP("indent", "", 2, "Spaces per level with --json-pretty")
+	Cmd.PersistentFlags().BoolP("infer-types", "", false, "Emit booleans and numbers as typed JSON/YAML values")
+	Cmd.PersistentFlags().BoolP("yaml", "", false, "Return in YAML format")
+	Cmd.PersistentFlags().BoolP("yaml-anchors", "", false, "Use YAML anchors/aliases for repeated values")
+	Cmd.PersistentFlags().BoolP("ini", "", false, "Return in INI format, one section per folder the variables were taken from")
+	Cmd.PersistentFlags().BoolP("ssm", "", false, "Return as a JSON array of AWS SSM parameters")
+	Cmd.PersistentFlags().BoolP("vault-kv", "", false, "Return as a Vault KV v2 write payload")
+	Cmd.PersistentFlags().StringP("vault-path", "", "", "Nest --vault-kv data under these path segments")
+	Cmd.PersistentFlags().BoolP("php", "", false, "Return as a PHP file returning an array")
+	Cmd.PersistentFlags().BoolP("laravel-env", "", false, "Return in Laravel .env format")
+	Cmd.PersistentFlags().BoolP("direnv", "", false, "Return as a direnv .envrc snippet")
+	Cmd.PersistentFlags().StringSliceP("direnv-watch", "", nil, "Add a watch_file directive for this file to --direnv output")
+	Cmd.PersistentFlags().BoolP("netrc", "", false, "Return in .netrc format")
+	Cmd.PersistentFlags().StringArrayP("netrc-entry", "", nil, "Variables for one --netrc machine entry, MACHINE_VAR,LOGIN_VAR,PASSWORD_VAR")
+	Cmd.PersistentFlags().StringP("ssm-prefix", "", "", "Parameter name prefix for --ssm, e.g. /myapp/prod")
+	Cmd.PersistentFlags().StringP("template-file", "t", "", "Render output with a Go text/template")
+	Cmd.PersistentFlags().StringP("output-file", "o", "", "Write output to file instead of stdout")
+	Cmd.PersistentFlags().BoolP("best-effort", "", false, "Warn about paths that fail to list and render the rest, exiting with 139")
+	Cmd.PersistentFlags().StringP("summary-format", "", "text", "Load summary format: text or json")
+	Cmd.PersistentFlags().StringP("summary-file", "", "", "Write the --summary-format json summary to this file instead of stderr")
+	Cmd.PersistentFlags().StringP("manifest", "", "", "Write the source key, datacenter, namespace and index of every variable to this JSON file")
+	Cmd.PersistentFlags().StringP("relative-to", "", "", "Prefix folder names are made relative to (default: the queried path)")
+	Cmd.PersistentFlags().StringP("output-dir", "", "", "Write each variable to its own file in this directory")
+	Cmd.PersistentFlags().BoolP("newline", "", false, "End --output-dir files with a newline")
+	Cmd.PersistentFlags().BoolP("split-by-prefix", "", false, "Write --output-dir as one <component>.env file per COMPONENT_ name prefix")
+	Cmd.PersistentFlags().StringP("split-separator", "", "_", "Separator ending the component prefix for --split-by-prefix")
+	Cmd.PersistentFlags().StringP("split-default", "", "default", "File name (without .env) for variables without a component prefix")
+	Cmd.PersistentFlags().BoolP("clean", "", false, "Remove --output-dir files of variables not in this run")
+	Cmd.PersistentFlags().StringSliceP("emit", "", nil, "Render to several outputs in one run, format:path (- for stdout)")
+	Cmd.PersistentFlags().Uint64P("secret-flag", "", 0, "Consul KV flags value marking a key as secret, masked in diagnostic output")
+	Cmd.PersistentFlags().DurationP("poll", "", 0, "Re-fetch on this interval and re-render when content changes")
+	Cmd.PersistentFlags().BoolP("poll-once-then-exit", "", false, "Retry until the first successful render, write it and exit")
+	Cmd.PersistentFlags().DurationP("max-wait", "", 0, "Fail --poll-once-then-exit if no render succeeded within this time")
+	Cmd.PersistentFlags().StringP("wait-for", "", "", "Wait until this key exists before fetching")
+	Cmd.PersistentFlags().DurationP("wait-timeout", "", 5*time.Minute, "Give up on --wait-for after this long, 0 waits forever")
+	Cmd.PersistentFlags().StringP("pre-hook", "", "", "Shell command to run before fetching, subcommands run no hooks")
+	Cmd.PersistentFlags().StringP("post-hook", "", "", "Shell command to run after fetching, with the exit status in CONSULENV_STATUS, subcommands run no hooks")
+	Cmd.PersistentFlags().BoolP("hook-fatal", "", false, "Exit with 138 when --pre-hook or --post-hook fails")
+	Cmd.PersistentFlags().StringP("on-change", "", "", "Shell command to run after output changed in --poll mode")
+	Cmd.PersistentFlags().StringP("env-from-last-segment", "", "", "Add a variable with this name holding the last segment of the first path, in its folder for --ini and templates")
+	Cmd.PersistentFlags().BoolP("resolve-services", "", false, "Replace ${service:NAME} in values with the address of a healthy instance")
+	Cmd.PersistentFlags().StringP("service-fallback", "", "", "Address used by --resolve-services when a service has no healthy instance")
+	Cmd.PersistentFlags().BoolP("expand-json", "", false, "Expand JSON object values into KEY_FIELD variables")
+	Cmd.PersistentFlags().BoolP("expand-json-nested", "", false, "Flatten nested objects with --expand-json instead of keeping them as JSON")
+	Cmd.PersistentFlags().BoolP("skip-empty", "", false, "Omit variables whose value is empty or whitespace only")
+	Cmd.PersistentFlags().StringP("strip-value-prefix", "", "", "Remove this prefix from values that start with it")
+	Cmd.PersistentFlags().StringSliceP("strip-value-keys", "", nil, "Only apply --strip-value-prefix to variables matching these names or globs")
+	Cmd.PersistentFlags().StringArrayP("value-fn", "", nil, "Transform values of KEY (or glob) with built-in functions, KEY=trim|upper|lower|base64decode|base64encode|urldecode")
+	Cmd.PersistentFlags().StringP("value-prefix", "", "", "Prepend this to every value")
+	Cmd.PersistentFlags().StringP("value-suffix", "", "", "Append this to every value")
+	Cmd.PersistentFlags().StringArrayP("when", "", nil, "Only output variables matching PATTERN while KEY holds value, KEY=value:PATTERN")
+	Cmd.PersistentFlags().StringP("value-match", "", "", "Only output variables whose value matches this regex, secret and --redact-pattern values masked")
+	Cmd.PersistentFlags().StringArrayP("validate", "", nil, "Check variables matching KEY against a regex or int, bool, url, email, KEY=rule (fatal with --strict)")
+	Cmd.PersistentFlags().StringP("select-file", "", "", "Only output variables listed in this file, one per line")
+	Cmd.PersistentFlags().BoolP("select-optional", "", false, "Do not fail when variables from --select-file are missing")
+	Cmd.PersistentFlags().StringSliceP("require", "", nil, "Fail unless these variables are present after the merge")
+	Cmd.PersistentFlags().StringP("on-missing-key", "", "", "Shell command run per missing --require variable, name in $MISSING_KEY")
+	Cmd.PersistentFlags().BoolP("fail-on-conflict-across-namespaces", "", false, "Fail when paths in different datacenters/namespaces define a variable with different values")
+	Cmd.PersistentFlags().BoolP("json-deep-merge", "", false, "Deep-merge JSON object values defined in several paths, earlier paths win per leaf")
+	Cmd.PersistentFlags().StringP("overlay", "", "", "Dotenv file with local variables merged over the Consul ones")
+	Cmd.PersistentFlags().BoolP("overlay-under", "", false, "Let Consul variables win over --overlay ones")
+	Cmd.PersistentFlags().StringP("baseline", "", "", "Only output variables new or changed against this dotenv file")
+	Cmd.PersistentFlags().BoolP("baseline-unset", "", false, "Emit unset lines for --baseline variables missing from Consul")
+	Cmd.PersistentFlags().BoolP("scan-secrets", "", false, "Warn about values that look like plaintext secrets")
+	Cmd.PersistentFlags().StringArrayP("redact-pattern", "", nil, "Mask value substrings matching this regex in diagnostic output")
+	Cmd.PersistentFlags().BoolP("group-by-folder", "", false, "Group output by the folder variables came from, nested in JSON/YAML")
+	Cmd.PersistentFlags().IntP("limit", "", 0, "Output at most N variables, in --sort-by order")
+	Cmd.PersistentFlags().BoolP("fill-only", "", false, "Only emit variables not already set in the environment")
+	Cmd.PersistentFlags().BoolP("fill-empty", "", false, "With --fill-only, also emit variables set to an empty value")
+	Cmd.PersistentFlags().StringP("name-template", "", "", "Go template giving each variable name, with .Folder, .Key and .Path, e.g. '{{upper .Folder}}_{{.Key}}'")
+	Cmd.PersistentFlags().StringP("naming", "", "", "Rename variables to screaming_snake, snake, kebab, camel or pascal (kebab, camel and pascal for json, yaml and template only)")
+	Cmd.PersistentFlags().StringP("sort-by", "", "key", "Output order: key (per path, in path order) or value")
+	Cmd.PersistentFlags().StringP("audit-log", "", "", "Append a JSON line per fetch (paths, key names, token accessor) to this file")
+	Cmd.PersistentFlags().IntP("retry-on-empty", "", 0, "Re-query up to N times while no keys are found")
+	Cmd.PersistentFlags().DurationP("retry-delay", "", time.Second, "Delay between --retry-on-empty and --poll-once-then-exit attempts")
+	Cmd.PersistentFlags().BoolP("fail-on-empty", "", false, "Fail when no keys are found, after retries")
+	Cmd.PersistentFlags().IntP("max-value-size", "", 1<<20, "Skip values larger than this many bytes, 0 disables")
+	Cmd.PersistentFlags().BoolP("warn-empty-dirs", "", false, "Warn about directory marker keys of folders without variables")
+	Cmd.PersistentFlags().BoolP("normalize-eol", "", false, "Convert CRLF and lone CR line endings in values to LF")
+	Cmd.PersistentFlags().BoolP("strip-trailing-cr", "", false, "Remove carriage returns at the end of values, keeping other line endings")
+	Cmd.PersistentFlags().BoolP("validate-utf8", "", false, "Report values that are not valid UTF-8")
+	Cmd.PersistentFlags().BoolP("replace-invalid", "", false, "Replace invalid UTF-8 in values with U+FFFD")
+	Cmd.PersistentFlags().StringP("binary-as", "", "", "Encode values that are not UTF-8 as hex or base64, marked in the --manifest")
+	Cmd.PersistentFlags().BoolP("strict", "", false, "Fail instead of skipping invalid values")
 	Cmd.PersistentFlags().BoolP("verbose", "v", false, "Verbosity")
+	Cmd.PersistentFlags().BoolP("timings", "", false, "Print Consul call durations and key counts to stderr")
+	Cmd.PersistentFlags().StringP("error-format", "", "text", "Format of fatal errors on stderr: text or json")
+	Cmd.PersistentFlags().StringP("log-format", "", "text", "Format of diagnostic output: text or json")
+	Cmd.PersistentFlags().StringSliceP("get-key", "", nil, "Get this full key instead of listing paths, repeatable")
+	Cmd.PersistentFlags().StringP("get-keys-file", "", "", "File with full keys to get, one per line")
 	Cmd.PersistentFlags().BoolP("keys", "k", false, "List keys under prefix")
+	Cmd.PersistentFlags().BoolP("counts", "", false, "With --keys, show the number of keys below each folder")
+	Cmd.PersistentFlags().BoolP("group-by-path", "", false, "With --keys, list each path separately in precedence order instead of one sorted list")
 
 	viper.BindPFlag("config", Cmd.PersistentFlags().Lookup("config"))
 	viper.BindPFlag("addr", Cmd.PersistentFlags().Lookup("addr"))
 	viper.BindPFlag("token", Cmd.PersistentFlags().Lookup("token"))
 	viper.BindPFlag("auth", Cmd.PersistentFlags().Lookup("auth"))
+	viper.BindPFlag("auth-user", Cmd.PersistentFlags().Lookup("auth-user"))
+	viper.BindPFlag("auth-password-file", Cmd.PersistentFlags().Lookup("auth-password-file"))
 	viper.BindPFlag("ssl", Cmd.PersistentFlags().Lookup("ssl"))
+	viper.BindPFlag("cluster", Cmd.PersistentFlags().Lookup("cluster"))
+	viper.BindPFlag("fallback-token", Cmd.PersistentFlags().Lookup("fallback-token"))
+	viper.BindPFlag("path-token", Cmd.PersistentFlags().Lookup("path-token"))
+	viper.BindPFlag("datacenter", Cmd.PersistentFlags().Lookup("datacenter"))
+	viper.BindPFlag("namespace", Cmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("validate-token", Cmd.PersistentFlags().Lookup("validate-token"))
 
 	viper.BindPFlag("path", Cmd.PersistentFlags().Lookup("path"))
+	viper.BindPFlag("cache-file", Cmd.PersistentFlags().Lookup("cache-file"))
+	viper.BindPFlag("cache-dir", Cmd.PersistentFlags().Lookup("cache-dir"))
+	viper.BindPFlag("offline", Cmd.PersistentFlags().Lookup("offline"))
+	viper.BindPFlag("prefix", Cmd.PersistentFlags().Lookup("prefix"))
+	viper.BindPFlag("consistent", Cmd.PersistentFlags().Lookup("consistent"))
+	viper.BindPFlag("with-descriptions", Cmd.PersistentFlags().Lookup("with-descriptions"))
+	viper.BindPFlag("key-separator", Cmd.PersistentFlags().Lookup("key-separator"))
+	viper.BindPFlag("flags-filter", Cmd.PersistentFlags().Lookup("flags-filter"))
+	viper.BindPFlag("modified-since-index", Cmd.PersistentFlags().Lookup("modified-since-index"))
+	viper.BindPFlag("state-file", Cmd.PersistentFlags().Lookup("state-file"))
+	viper.BindPFlag("exclude-path", Cmd.PersistentFlags().Lookup("exclude-path"))
+	viper.BindPFlag("service", Cmd.PersistentFlags().Lookup("service"))
+	viper.BindPFlag("env", Cmd.PersistentFlags().Lookup("env"))
+	viper.BindPFlag("service-path-template", Cmd.PersistentFlags().Lookup("service-path-template"))
+	viper.BindPFlag("service-base-template", Cmd.PersistentFlags().Lookup("service-base-template"))
+	viper.BindPFlag("path-template", Cmd.PersistentFlags().Lookup("path-template"))
 	viper.BindPFlag("export", Cmd.PersistentFlags().Lookup("export"))
+	viper.BindPFlag("bash-array", Cmd.PersistentFlags().Lookup("bash-array"))
 	viper.BindPFlag("json", Cmd.PersistentFlags().Lookup("json"))
+	viper.BindPFlag("json-pretty", Cmd.PersistentFlags().Lookup("json-pretty"))
+	viper.BindPFlag("indent", Cmd.PersistentFlags().Lookup("indent"))
+	viper.BindPFlag("infer-types", Cmd.PersistentFlags().Lookup("infer-types"))
+	viper.BindPFlag("yaml", Cmd.PersistentFlags().Lookup("yaml"))
+	viper.BindPFlag("yaml-anchors", Cmd.PersistentFlags().Lookup("yaml-anchors"))
+	viper.BindPFlag("ini", Cmd.PersistentFlags().Lookup("ini"))
+	viper.BindPFlag("ssm", Cmd.PersistentFlags().Lookup("ssm"))
+	viper.BindPFlag("vault-kv", Cmd.PersistentFlags().Lookup("vault-kv"))
+	viper.BindPFlag("vault-path", Cmd.PersistentFlags().Lookup("vault-path"))
+	viper.BindPFlag("php", Cmd.PersistentFlags().Lookup("php"))
+	viper.BindPFlag("laravel-env", Cmd.PersistentFlags().Lookup("laravel-env"))
+	viper.BindPFlag("direnv", Cmd.PersistentFlags().Lookup("direnv"))
+	viper.BindPFlag("direnv-watch", Cmd.PersistentFlags().Lookup("direnv-watch"))
+	viper.BindPFlag("netrc", Cmd.PersistentFlags().Lookup("netrc"))
+	viper.BindPFlag("netrc-entry", Cmd.PersistentFlags().Lookup("netrc-entry"))
+	viper.BindPFlag("ssm-prefix", Cmd.PersistentFlags().Lookup("ssm-prefix"))
+	viper.BindPFlag("template-file", Cmd.PersistentFlags().Lookup("template-file"))
+	viper.BindPFlag("output-file", Cmd.PersistentFlags().Lookup("output-file"))
+	viper.BindPFlag("best-effort", Cmd.PersistentFlags().Lookup("best-effort"))
+	viper.BindPFlag("summary-format", Cmd.PersistentFlags().Lookup("summary-format"))
+	viper.BindPFlag("summary-file", Cmd.PersistentFlags().Lookup("summary-file"))
+	viper.BindPFlag("manifest", Cmd.PersistentFlags().Lookup("manifest"))
+	viper.BindPFlag("relative-to", Cmd.PersistentFlags().Lookup("relative-to"))
+	viper.BindPFlag("output-dir", Cmd.PersistentFlags().Lookup("output-dir"))
+	viper.BindPFlag("newline", Cmd.PersistentFlags().Lookup("newline"))
+	viper.BindPFlag("split-by-prefix", Cmd.PersistentFlags().Lookup("split-by-prefix"))
+	viper.BindPFlag("split-separator", Cmd.PersistentFlags().Lookup("split-separator"))
+	viper.BindPFlag("split-default", Cmd.PersistentFlags().Lookup("split-default"))
+	viper.BindPFlag("clean", Cmd.PersistentFlags().Lookup("clean"))
+	viper.BindPFlag("emit", Cmd.PersistentFlags().Lookup("emit"))
+	viper.BindPFlag("secret-flag", Cmd.PersistentFlags().Lookup("secret-flag"))
+	viper.BindPFlag("poll", Cmd.PersistentFlags().Lookup("poll"))
+	viper.BindPFlag("poll-once-then-exit", Cmd.PersistentFlags().Lookup("poll-once-then-exit"))
+	viper.BindPFlag("max-wait", Cmd.PersistentFlags().Lookup("max-wait"))
+	viper.BindPFlag("wait-for", Cmd.PersistentFlags().Lookup("wait-for"))
+	viper.BindPFlag("wait-timeout", Cmd.PersistentFlags().Lookup("wait-timeout"))
+	viper.BindPFlag("pre-hook", Cmd.PersistentFlags().Lookup("pre-hook"))
+	viper.BindPFlag("post-hook", Cmd.PersistentFlags().Lookup("post-hook"))
+	viper.BindPFlag("hook-fatal", Cmd.PersistentFlags().Lookup("hook-fatal"))
+	viper.BindPFlag("on-change", Cmd.PersistentFlags().Lookup("on-change"))
+	viper.BindPFlag("env-from-last-segment", Cmd.PersistentFlags().Lookup("env-from-last-segment"))
+	viper.BindPFlag("resolve-services", Cmd.PersistentFlags().Lookup("resolve-services"))
+	viper.BindPFlag("service-fallback", Cmd.PersistentFlags().Lookup("service-fallback"))
+	viper.BindPFlag("expand-json", Cmd.PersistentFlags().Lookup("expand-json"))
+	viper.BindPFlag("expand-json-nested", Cmd.PersistentFlags().Lookup("expand-json-nested"))
+	viper.BindPFlag("skip-empty", Cmd.PersistentFlags().Lookup("skip-empty"))
+	viper.BindPFlag("strip-value-prefix", Cmd.PersistentFlags().Lookup("strip-value-prefix"))
+	viper.BindPFlag("strip-value-keys", Cmd.PersistentFlags().Lookup("strip-value-keys"))
+	viper.BindPFlag("value-fn", Cmd.PersistentFlags().Lookup("value-fn"))
+	viper.BindPFlag("value-prefix", Cmd.PersistentFlags().Lookup("value-prefix"))
+	viper.BindPFlag("value-suffix", Cmd.PersistentFlags().Lookup("value-suffix"))
+	viper.BindPFlag("when", Cmd.PersistentFlags().Lookup("when"))
+	viper.BindPFlag("value-match", Cmd.PersistentFlags().Lookup("value-match"))
+	viper.BindPFlag("validate", Cmd.PersistentFlags().Lookup("validate"))
+	viper.BindPFlag("select-file", Cmd.PersistentFlags().Lookup("select-file"))
+	viper.BindPFlag("select-optional", Cmd.PersistentFlags().Lookup("select-optional"))
+	viper.BindPFlag("require", Cmd.PersistentFlags().Lookup("require"))
+	viper.BindPFlag("on-missing-key", Cmd.PersistentFlags().Lookup("on-missing-key"))
+	viper.BindPFlag("fail-on-conflict-across-namespaces", Cmd.PersistentFlags().Lookup("fail-on-conflict-across-namespaces"))
+	viper.BindPFlag("json-deep-merge", Cmd.PersistentFlags().Lookup("json-deep-merge"))
+	viper.BindPFlag("overlay", Cmd.PersistentFlags().Lookup("overlay"))
+	viper.BindPFlag("overlay-under", Cmd.PersistentFlags().Lookup("overlay-under"))
+	viper.BindPFlag("baseline", Cmd.PersistentFlags().Lookup("baseline"))
+	viper.BindPFlag("baseline-unset", Cmd.PersistentFlags().Lookup("baseline-unset"))
+	viper.BindPFlag("scan-secrets", Cmd.PersistentFlags().Lookup("scan-secrets"))
+	viper.BindPFlag("redact-pattern", Cmd.PersistentFlags().Lookup("redact-pattern"))
+	viper.BindPFlag("group-by-folder", Cmd.PersistentFlags().Lookup("group-by-folder"))
+	viper.BindPFlag("limit", Cmd.PersistentFlags().Lookup("limit"))
+	viper.BindPFlag("fill-only", Cmd.PersistentFlags().Lookup("fill-only"))
+	viper.BindPFlag("fill-empty", Cmd.PersistentFlags().Lookup("fill-empty"))
+	viper.BindPFlag("name-template", Cmd.PersistentFlags().Lookup("name-template"))
+	viper.BindPFlag("naming", Cmd.PersistentFlags().Lookup("naming"))
+	viper.BindPFlag("sort-by", Cmd.PersistentFlags().Lookup("sort-by"))
+	viper.BindPFlag("audit-log", Cmd.PersistentFlags().Lookup("audit-log"))
+	viper.BindPFlag("retry-on-empty", Cmd.PersistentFlags().Lookup("retry-on-empty"))
+	viper.BindPFlag("retry-delay", Cmd.PersistentFlags().Lookup("retry-delay"))
+	viper.BindPFlag("fail-on-empty", Cmd.PersistentFlags().Lookup("fail-on-empty"))
+	viper.BindPFlag("max-value-size", Cmd.PersistentFlags().Lookup("max-value-size"))
+	viper.BindPFlag("warn-empty-dirs", Cmd.PersistentFlags().Lookup("warn-empty-dirs"))
+	viper.BindPFlag("normalize-eol", Cmd.PersistentFlags().Lookup("normalize-eol"))
+	viper.BindPFlag("strip-trailing-cr", Cmd.PersistentFlags().Lookup("strip-trailing-cr"))
+	viper.BindPFlag("validate-utf8", Cmd.PersistentFlags().Lookup("validate-utf8"))
+	viper.BindPFlag("replace-invalid", Cmd.PersistentFlags().Lookup("replace-invalid"))
+	viper.BindPFlag("binary-as", Cmd.PersistentFlags().Lookup("binary-as"))
+	viper.BindPFlag("strict", Cmd.PersistentFlags().Lookup("strict"))
 	viper.BindPFlag("verbose", Cmd.PersistentFlags().Lookup("verbose"))
+	viper.BindPFlag("timings", Cmd.PersistentFlags().Lookup("timings"))
+	viper.BindPFlag("error-format", Cmd.PersistentFlags().Lookup("error-format"))
+	viper.BindPFlag("log-format", Cmd.PersistentFlags().Lookup("log-format"))
+	viper.BindPFlag("get-key", Cmd.PersistentFlags().Lookup("get-key"))
+	viper.BindPFlag("get-keys-file", Cmd.PersistentFlags().Lookup("get-keys-file"))
 	viper.BindPFlag("keys", Cmd.PersistentFlags().Lookup("keys"))
+	viper.BindPFlag("counts", Cmd.PersistentFlags().Lookup("counts"))
+	viper.BindPFlag("group-by-path", Cmd.PersistentFlags().Lookup("group-by-path"))
 
 	viper.BindEnv("addr", "CONSUL_HTTP_ADDR")
 	viper.BindEnv("token", "CONSUL_HTTP_TOKEN")
@@ -86,25 +324,66 @@ func initConfig() {
 	addr := viper.GetString("addr")
 	token := viper.GetString("token")
 
-	if addr == "" || token == "" {
-		fmt.Println("You need to configure access to Consul server through: config file/env/flags")
-		os.Exit(1)
+	if (addr == "" || token == "") && !completing() {
+		consul.Fail(1, "You need to configure access to Consul server through: config file/env/flags")
 	}
 }
 
+// Context cancelled on SIGINT/SIGTERM, so in-flight Consul queries abort cleanly
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
 func fetch(ccmd *cobra.Command, args []string) {
-	paths := viper.GetStringSlice("path")
+	paths := consul.Paths()
 	keys := viper.GetBool("keys")
 
 	if len(paths) == 0 {
-		fmt.Fprintln(os.Stderr, "At least one -p required.")
 		ccmd.HelpFunc()(ccmd, args)
-		os.Exit(1)
+		consul.Fail(1, "At least one -p, --service or --path-template required.")
+	}
+
+	if sortBy := viper.GetString("sort-by"); sortBy != "key" && sortBy != "value" {
+		consul.Fail(1, "Invalid --sort-by, expected key or value.")
+	}
+
+	if err := consul.CheckValueFns(); err != nil {
+		consul.Fail(1, "%s", err)
+	}
+
+	if format := viper.GetString("summary-format"); format != "text" && format != "json" {
+		consul.Fail(1, "Invalid --summary-format, expected text or json.")
 	}
 
+	if err := consul.CheckNaming(); err != nil {
+		consul.Fail(1, "%s", err)
+	}
+
+	if err := consul.CheckBashArray(); err != nil {
+		consul.Fail(1, "%s", err)
+	}
+
+	if err := consul.CheckListFlags(); err != nil {
+		consul.Fail(1, "%s", err)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	consul.PreHook()
+	defer consul.PostHook(0)
+
+	consul.WaitForKey(ctx)
+
 	if keys {
-		consul.Keys()
+		consul.Keys(ctx)
+	} else if len(viper.GetStringSlice("cluster")) > 0 {
+		consul.GetClusters(ctx)
+	} else if viper.GetBool("poll-once-then-exit") {
+		consul.Once(ctx, viper.GetDuration("max-wait"))
+	} else if interval := viper.GetDuration("poll"); interval > 0 {
+		consul.Poll(ctx, interval)
 	} else {
-		consul.Get()
+		consul.Get(ctx)
 	}
 }
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var completePathCmd = &cobra.Command{
+	Use:    "__complete-path [partial]",
+	Short:  "List Consul folders matching a partial path",
+	Hidden: true,
+	Args:   cobra.MaximumNArgs(1),
+	Run: func(ccmd *cobra.Command, args []string) {
+		var partial string
+		if len(args) > 0 {
+			partial = args[0]
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		for _, folder := range consul.CompletePaths(ctx, partial) {
+			fmt.Println(folder)
+		}
+	},
+}
+
+func completePath(ccmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ctx, stop := signalContext()
+	defer stop()
+
+	return consul.CompletePaths(ctx, toComplete), cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+// Check if the shell is asking for completions, which must fail quietly
+// instead of printing configuration errors
+func completing() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	switch os.Args[1] {
+	case cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd, completePathCmd.Name():
+		return true
+	}
+	return false
+}
+
+func init() {
+	Cmd.AddCommand(completePathCmd)
+	Cmd.RegisterFlagCompletionFunc("path", completePath)
+}
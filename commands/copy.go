@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy <source> <destination>",
+	Short: "Copy a key or subtree to another prefix or cluster",
+	Args:  cobra.ExactArgs(2),
+	Run: func(ccmd *cobra.Command, args []string) {
+		toAddr, _ := ccmd.Flags().GetString("to-addr")
+		dryRun, _ := ccmd.Flags().GetBool("dry-run")
+		overwrite, _ := ccmd.Flags().GetBool("overwrite")
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Copy(ctx, args[0], args[1], toAddr, dryRun, overwrite)
+	},
+}
+
+func init() {
+	copyCmd.Flags().StringP("to-addr", "", "", "Consul server to copy to, defaults to --addr")
+	copyCmd.Flags().BoolP("dry-run", "", false, "Only print the keys that would be copied")
+	copyCmd.Flags().BoolP("overwrite", "", false, "Replace destination keys holding another value")
+
+	Cmd.AddCommand(copyCmd)
+}
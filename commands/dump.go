@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print every key under the paths with its raw value",
+	Args:  cobra.NoArgs,
+	Run: func(ccmd *cobra.Command, args []string) {
+		if len(consul.Paths()) == 0 {
+			consul.Fail(1, "At least one -p, --service or --path-template required.")
+		}
+		if err := consul.CheckListFlags(); err != nil {
+			consul.Fail(1, "%s", err)
+		}
+		mask, _ := ccmd.Flags().GetBool("mask")
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Dump(ctx, mask, viper.GetBool("json"))
+	},
+}
+
+func init() {
+	dumpCmd.Flags().BoolP("mask", "m", false, "Mask secret-flagged values and --redact-pattern matches")
+
+	Cmd.AddCommand(dumpCmd)
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <path> <file>",
+	Short: "Write the variables of a dotenv file under a Consul path",
+	Args:  cobra.ExactArgs(2),
+	Run: func(ccmd *cobra.Command, args []string) {
+		dryRun, _ := ccmd.Flags().GetBool("dry-run")
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Import(ctx, args[0], args[1], dryRun)
+	},
+}
+
+func init() {
+	importCmd.Flags().BoolP("dry-run", "", false, "Show new, changed and unchanged keys without writing")
+
+	Cmd.AddCommand(importCmd)
+}
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var namespacesCmd = &cobra.Command{
+	Use:   "namespaces [path]",
+	Short: "List namespaces with the number of keys under path (Consul Enterprise)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(ccmd *cobra.Command, args []string) {
+		path := ""
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Namespaces(ctx, path)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(namespacesCmd)
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <source> <destination>",
+	Short: "Move a key or subtree to another prefix",
+	Args:  cobra.ExactArgs(2),
+	Run: func(ccmd *cobra.Command, args []string) {
+		dryRun, _ := ccmd.Flags().GetBool("dry-run")
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Rename(ctx, args[0], args[1], dryRun)
+	},
+}
+
+func init() {
+	renameCmd.Flags().BoolP("dry-run", "", false, "Only print the keys that would be moved")
+
+	Cmd.AddCommand(renameCmd)
+}
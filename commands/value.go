@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var valueCmd = &cobra.Command{
+	Use:   "value <key>",
+	Short: "Print the raw value of a single key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(ccmd *cobra.Command, args []string) {
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.GetValue(ctx, args[0])
+	},
+}
+
+func init() {
+	valueCmd.Flags().BoolP("no-newline", "n", false, "Do not append a trailing newline to the value")
+	viper.BindPFlag("no-newline", valueCmd.Flags().Lookup("no-newline"))
+
+	Cmd.AddCommand(valueCmd)
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"consulenv/consul"
+
+	"github.com/spf13/cobra"
+)
+
+var whereCmd = &cobra.Command{
+	Use:   "where <variable>",
+	Short: "Show every queried key defining a variable, and which one is used",
+	Args:  cobra.ExactArgs(1),
+	Run: func(ccmd *cobra.Command, args []string) {
+		if len(consul.Paths()) == 0 {
+			consul.Fail(1, "At least one -p, --service or --path-template required.")
+		}
+		if err := consul.CheckListFlags(); err != nil {
+			consul.Fail(1, "%s", err)
+		}
+		mask, _ := ccmd.Flags().GetBool("mask")
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		consul.Where(ctx, args[0], mask)
+	},
+}
+
+func init() {
+	whereCmd.Flags().BoolP("mask", "m", false, "Mask secret-flagged values and --redact-pattern matches")
+
+	Cmd.AddCommand(whereCmd)
+}
@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+type auditEntry struct {
+	Time       string   `json:"time"`
+	Address    string   `json:"address"`
+	Paths      []string `json:"paths"`
+	Keys       []string `json:"keys"`
+	AccessorID string   `json:"accessor_id,omitempty"`
+	User       string   `json:"user,omitempty"`
+	Host       string   `json:"host,omitempty"`
+}
+
+// Append a JSON line describing the fetch to --audit-log. Only key names are
+// recorded, never values.
+func audit(ctx context.Context, consul *consulapi.Client, snap *snapshot) {
+	file := viper.GetString("audit-log")
+	if file == "" {
+		return
+	}
+
+	entry := auditEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Address: clientAddr(consul),
+		Paths:   snap.paths,
+		Keys:    snap.keys,
+	}
+	// Empty lists are [], not null
+	if entry.Paths == nil {
+		entry.Paths = []string{}
+	}
+	if entry.Keys == nil {
+		entry.Keys = []string{}
+	}
+
+	if token, _, err := consul.ACL().TokenReadSelf(queryOptions(ctx)); err == nil {
+		entry.AccessorID = token.AccessorID
+	} else if viper.GetBool("verbose") {
+		fmt.Fprintln(os.Stderr, "Unable to read token accessor for audit log:", err)
+	}
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	entry.Host, _ = os.Hostname()
+
+	line, _ := json.Marshal(entry)
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fail(134, "", "Error writing audit log: %s", err)
+	}
+}
@@ -0,0 +1,52 @@
+package consul
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Read basic auth password from a file ("-" for stdin) or, when no file is
+// given, prompt for it on the terminal.
+func readPassword(file string) (string, error) {
+	var pass string
+
+	switch file {
+	case "":
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return "", errors.New("no password source, use --auth-password-file")
+		}
+		fmt.Fprint(os.Stderr, "Consul password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		pass = string(b)
+	case "-":
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		pass = line
+	default:
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		pass = string(b)
+	}
+
+	pass = strings.TrimRight(pass, "\r\n")
+	if pass == "" {
+		return "", errors.New("empty password")
+	}
+	return pass, nil
+}
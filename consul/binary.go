@@ -0,0 +1,14 @@
+package consul
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Text form of a binary value for --binary-as hex or base64
+func encodeBinary(encoding string, value []byte) string {
+	if encoding == "hex" {
+		return hex.EncodeToString(value)
+	}
+	return base64.StdEncoding.EncodeToString(value)
+}
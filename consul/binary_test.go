@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Values that are not valid UTF-8 are encoded with --binary-as and their
+// encoding recorded in the manifest, text values are left as they are
+func TestBinaryAs(t *testing.T) {
+	stub := newConsulStub(t, "app/BIN", "\xff\x00\x01", "app/TEXT", "plain")
+
+	tests := []struct {
+		binaryAs string
+		want     string
+	}{
+		{binaryAs: "", want: "\xff\x00\x01"},
+		{binaryAs: "hex", want: "ff0001"},
+		{binaryAs: "base64", want: "/wAB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.binaryAs, func(t *testing.T) {
+			manifest := filepath.Join(t.TempDir(), "manifest.json")
+			var snap *snapshot
+			out := captureStderr(t, func() {
+				snap = fetchSnapshot(t, stub, func() {
+					viper.Set("path", []string{"app"})
+					viper.Set("binary-as", tt.binaryAs)
+					viper.Set("validate-utf8", true)
+				})
+			})
+			if snap.env["BIN"] != tt.want || snap.env["TEXT"] != "plain" {
+				t.Errorf("env %q, want BIN=%q and TEXT unchanged", snap.env, tt.want)
+			}
+			// Encoded values are valid UTF-8 by then
+			if invalid := strings.Contains(out, "Invalid UTF-8: app/BIN"); invalid != (tt.binaryAs == "") {
+				t.Errorf("stderr %q, want invalid UTF-8 reported only for raw values", out)
+			}
+
+			if err := writeManifest(manifest, snap); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entries map[string]manifestEntry
+			if err := json.Unmarshal(data, &entries); err != nil {
+				t.Fatal(err)
+			}
+			if entries["BIN"].Encoding != tt.binaryAs || entries["TEXT"].Encoding != "" {
+				t.Errorf("manifest encodings BIN=%q TEXT=%q, want BIN=%q and none for TEXT", entries["BIN"].Encoding, entries["TEXT"].Encoding, tt.binaryAs)
+			}
+		})
+	}
+}
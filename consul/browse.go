@@ -0,0 +1,342 @@
+package consul
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+const browseHelp = "up/down move, enter/right open or toggle, space toggle, left/backspace up, e export, q quit"
+
+// Terminal control sequences of the browser screen
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l" // alternate screen, cursor hidden
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	normal      = "\x1b[0m"
+)
+
+// State of the terminal browser: the folder shown, the entry under the
+// cursor and the keys toggled into the selection
+type browser struct {
+	ctx      context.Context
+	kv       *consulapi.KV
+	qp       queryPath
+	sep      string
+	folder   string
+	entries  []string
+	cursor   int
+	selected map[string]bool
+	status   string
+}
+
+// Browse shows the KV tree from start full screen on the terminal, one
+// level at a time, with keys toggled into a selection. Exporting renders
+// the selected keys, named after their last segment, in the chosen output
+// format once the terminal is restored.
+func Browse(ctx context.Context, start string) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		fail(1, "", "browse needs a terminal, use -p with --keys to list non-interactively")
+	}
+
+	consul := connect(ctx)
+	qp := parsePath(start)
+	b := &browser{ctx: ctx, kv: consul.KV(), qp: qp, sep: keySeparator(), selected: map[string]bool{}}
+	if err := b.open(qp.path); err != nil {
+		exitOnCancel(ctx)
+		fail(133, qp.qualifier()+qp.path, "%s", err)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fail(1, "", "Unable to set up the terminal: %s", err)
+	}
+	restore := func() {
+		fmt.Fprint(os.Stderr, leaveScreen)
+		term.Restore(fd, state)
+	}
+	fmt.Fprint(os.Stderr, enterScreen)
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		_, height, err := term.GetSize(int(os.Stderr.Fd()))
+		if err != nil {
+			height = 24
+		}
+		b.draw(os.Stderr, height)
+
+		key, err := readKey(in)
+		if err != nil {
+			restore()
+			return
+		}
+		quit, export, err := b.handle(key)
+		if err != nil {
+			restore()
+			exitOnCancel(ctx)
+			fail(133, b.qp.qualifier()+b.folder, "%s", err)
+		}
+		if !quit {
+			continue
+		}
+
+		restore()
+		if export {
+			snap, err := browseSnapshot(ctx, b.kv, qp, sortedSelection(b.selected), b.sep)
+			if err != nil {
+				exitOnCancel(ctx)
+				fail(133, "", "%s", err)
+			}
+			writeOutputs(snap, renderOutputs(snap))
+		}
+		return
+	}
+}
+
+// Read one key press from a terminal in raw mode, arrow keys as up, down,
+// left and right
+func readKey(in *bufio.Reader) (string, error) {
+	c, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\r', '\n':
+		return "enter", nil
+	case ' ':
+		return "space", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x03, 0x04:
+		return "q", nil
+	case 0x1b:
+		// CSI sequences of the arrow keys, a lone escape is ignored
+		if in.Buffered() < 2 {
+			return "esc", nil
+		}
+		b1, _ := in.ReadByte()
+		b2, _ := in.ReadByte()
+		if b1 == '[' || b1 == 'O' {
+			switch b2 {
+			case 'A':
+				return "up", nil
+			case 'B':
+				return "down", nil
+			case 'C':
+				return "right", nil
+			case 'D':
+				return "left", nil
+			}
+		}
+		return "esc", nil
+	}
+	return string(c), nil
+}
+
+// List folder and put the cursor on its first entry
+func (b *browser) open(folder string) error {
+	prefix := folder
+	if prefix != "" {
+		prefix += b.sep
+	}
+	entries, _, err := b.kv.Keys(prefix, b.sep, b.qp.options(b.ctx))
+	if err != nil {
+		return err
+	}
+	b.folder = folder
+	b.entries = browseEntries(entries, prefix)
+	b.cursor = 0
+	return nil
+}
+
+// Apply a key press, reporting whether to quit and whether to export the
+// selection then
+func (b *browser) handle(key string) (quit bool, export bool, err error) {
+	b.status = ""
+	var current string
+	if b.cursor < len(b.entries) {
+		current = b.entries[b.cursor]
+	}
+	folder := strings.HasSuffix(current, b.sep)
+
+	switch key {
+	case "up", "k":
+		if b.cursor > 0 {
+			b.cursor--
+		}
+	case "down", "j":
+		if b.cursor < len(b.entries)-1 {
+			b.cursor++
+		}
+	case "enter", "right", "l", "space":
+		switch {
+		case current == "":
+		case folder && key != "space":
+			return false, false, b.open(strings.TrimSuffix(current, b.sep))
+		case !folder:
+			if b.selected[current] {
+				delete(b.selected, current)
+			} else {
+				b.selected[current] = true
+			}
+		}
+	case "left", "h", "backspace":
+		if b.folder == "" {
+			break
+		}
+		from := b.folder + b.sep
+		parent := ""
+		if i := strings.LastIndex(b.folder, b.sep); i >= 0 {
+			parent = b.folder[:i]
+		}
+		if err := b.open(parent); err != nil {
+			return false, false, err
+		}
+		// Back on the folder just left
+		for i, k := range b.entries {
+			if k == from {
+				b.cursor = i
+			}
+		}
+	case "e":
+		if len(b.selected) == 0 {
+			b.status = "Nothing selected"
+			break
+		}
+		return true, true, nil
+	case "q", "esc":
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+// Draw the current folder, scrolled to keep the cursor within height lines
+func (b *browser) draw(w io.Writer, height int) {
+	prefix := b.folder
+	if prefix != "" {
+		prefix += b.sep
+	}
+	var out strings.Builder
+	out.WriteString(clearScreen)
+	fmt.Fprintf(&out, "%s%s/  (%d selected)\r\n", b.qp.qualifier(), b.folder, len(b.selected))
+
+	rows := height - 3
+	if rows < 1 {
+		rows = 1
+	}
+	first := 0
+	if b.cursor >= rows {
+		first = b.cursor - rows + 1
+	}
+	for i := first; i < len(b.entries) && i < first+rows; i++ {
+		k := b.entries[i]
+		mark := "   "
+		if b.selected[k] {
+			mark = "[x]"
+		} else if !strings.HasSuffix(k, b.sep) {
+			mark = "[ ]"
+		}
+		line := fmt.Sprintf("%s %s", mark, strings.TrimPrefix(k, prefix))
+		if i == b.cursor {
+			line = reverse + line + normal
+		}
+		out.WriteString(line + "\r\n")
+	}
+	if len(b.entries) == 0 {
+		out.WriteString("   (empty)\r\n")
+	}
+
+	status := b.status
+	if status == "" {
+		status = browseHelp
+	}
+	out.WriteString("\r\n" + status)
+	io.WriteString(w, out.String())
+}
+
+// Folders first, then keys, leaving out the folder's own directory marker
+func browseEntries(entries []string, prefix string) []string {
+	var folders, keys []string
+	for _, k := range entries {
+		switch {
+		case k == prefix:
+		case strings.HasSuffix(k, keySeparator()):
+			folders = append(folders, k)
+		default:
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(folders)
+	sort.Strings(keys)
+	return append(folders, keys...)
+}
+
+func sortedSelection(selected map[string]bool) []string {
+	var keys []string
+	for k := range selected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Read the selected keys into a snapshot, one folder per parent of a key.
+// Keys not named like a variable are skipped, when two keys share a name
+// the first in sorted order wins.
+func browseSnapshot(ctx context.Context, kv *consulapi.KV, qp queryPath, keys []string, sep string) (*snapshot, error) {
+	snap := &snapshot{
+		envMap:  map[string]map[string]*consulapi.KVPair{},
+		env:     map[string]string{},
+		secrets: map[string]bool{},
+		sources: map[string]string{},
+	}
+	secretFlag := viper.GetUint64("secret-flag")
+
+	for _, key := range keys {
+		kvPair, _, err := kv.Get(key, qp.options(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if kvPair == nil {
+			return nil, errors.New("key removed while browsing: " + key)
+		}
+
+		parent, name := "", key
+		if i := strings.LastIndex(key, sep); i >= 0 {
+			parent, name = key[:i], key[i+len(sep):]
+		}
+		if name == "" || !varNamePattern.MatchString(name) {
+			fmt.Fprintf(os.Stderr, "Skipping %s, %s is not a valid variable name\n", key, name)
+			continue
+		}
+		folder := queryPath{path: parent, datacenter: qp.datacenter, namespace: qp.namespace}.String()
+		if _, ok := snap.envMap[folder]; !ok {
+			snap.envMap[folder] = map[string]*consulapi.KVPair{}
+			snap.paths = append(snap.paths, folder)
+		}
+		snap.envMap[folder][name] = kvPair
+
+		if _, ok := snap.env[name]; ok {
+			fmt.Fprintf(os.Stderr, "Skipping %s, %s already taken from %s\n", key, name, snap.sources[name])
+			continue
+		}
+		snap.keys = append(snap.keys, name)
+		snap.env[name] = string(kvPair.Value)
+		snap.sources[name] = folder
+		if secretFlag != 0 && kvPair.Flags == secretFlag {
+			snap.secrets[name] = true
+		}
+	}
+	return snap, nil
+}
@@ -0,0 +1,109 @@
+package consul
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadKey(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("\x1b[A\x1b[B\x1b[C\x1b[D\r \x7fqe\x03"))
+	want := []string{"up", "down", "right", "left", "enter", "space", "backspace", "q", "e", "q"}
+	var got []string
+	for range want {
+		key, err := readKey(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, key)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keys %q, want %q", got, want)
+	}
+	if _, err := readKey(in); err == nil {
+		t.Error("key read past the input")
+	}
+}
+
+func TestBrowserKeys(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1", "app/db/B", "2", "app/bad-name", "3", "other/C", "4")
+	b := &browser{ctx: context.Background(), kv: stub.client().KV(), sep: "/", selected: map[string]bool{}}
+	if err := b.open(""); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		key      string
+		folder   string
+		current  string
+		selected []string
+		quit     bool
+	}{
+		{key: "enter", folder: "app", current: "app/db/"},
+		{key: "space", folder: "app", current: "app/db/"},
+		{key: "down", folder: "app", current: "app/A"},
+		{key: "space", folder: "app", current: "app/A", selected: []string{"app/A"}},
+		{key: "down", folder: "app", current: "app/bad-name", selected: []string{"app/A"}},
+		{key: "enter", folder: "app", current: "app/bad-name", selected: []string{"app/A", "app/bad-name"}},
+		{key: "up", folder: "app", current: "app/A", selected: []string{"app/A", "app/bad-name"}},
+		{key: "up", folder: "app", current: "app/db/", selected: []string{"app/A", "app/bad-name"}},
+		{key: "right", folder: "app/db", current: "app/db/B", selected: []string{"app/A", "app/bad-name"}},
+		{key: "enter", folder: "app/db", current: "app/db/B", selected: []string{"app/A", "app/bad-name", "app/db/B"}},
+		{key: "left", folder: "app", current: "app/db/", selected: []string{"app/A", "app/bad-name", "app/db/B"}},
+		{key: "backspace", folder: "", current: "app/", selected: []string{"app/A", "app/bad-name", "app/db/B"}},
+		{key: "e", folder: "", current: "app/", selected: []string{"app/A", "app/bad-name", "app/db/B"}, quit: true},
+	}
+	for i, step := range steps {
+		quit, export, err := b.handle(step.key)
+		if err != nil {
+			t.Fatalf("step %d %s: %s", i, step.key, err)
+		}
+		if b.folder != step.folder || b.entries[b.cursor] != step.current {
+			t.Errorf("step %d %s: at %q on %q, want %q on %q", i, step.key, b.folder, b.entries[b.cursor], step.folder, step.current)
+		}
+		if got := sortedSelection(b.selected); !reflect.DeepEqual(got, step.selected) {
+			t.Errorf("step %d %s: selected %q, want %q", i, step.key, got, step.selected)
+		}
+		if quit != step.quit || export != step.quit {
+			t.Errorf("step %d %s: quit %v export %v, want %v", i, step.key, quit, export, step.quit)
+		}
+	}
+
+	// Exported names must be variable names
+	var snap *snapshot
+	out := captureStderr(t, func() {
+		var err error
+		if snap, err = browseSnapshot(context.Background(), b.kv, b.qp, sortedSelection(b.selected), "/"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !reflect.DeepEqual(snap.keys, []string{"A", "B"}) || snap.env["A"] != "1" || snap.env["B"] != "2" {
+		t.Errorf("exported %q %v, want A=1 and B=2", snap.keys, snap.env)
+	}
+	if !strings.Contains(out, "bad-name is not a valid variable name") {
+		t.Errorf("stderr %q, want the invalid name reported", out)
+	}
+}
+
+func TestBrowserNothingSelected(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1")
+	b := &browser{ctx: context.Background(), kv: stub.client().KV(), sep: "/", selected: map[string]bool{}}
+	if err := b.open("app"); err != nil {
+		t.Fatal(err)
+	}
+	if quit, _, _ := b.handle("e"); quit || b.status != "Nothing selected" {
+		t.Errorf("export of nothing quit %v with %q", quit, b.status)
+	}
+	var screen strings.Builder
+	b.draw(&screen, 10)
+	if !strings.Contains(screen.String(), "Nothing selected") || !strings.Contains(screen.String(), reverse+"[ ] A"+normal) {
+		t.Errorf("screen %q, want the status and A under the cursor", screen.String())
+	}
+	if quit, export, _ := b.handle("q"); !quit || export {
+		t.Errorf("q quit %v export %v, want quit only", quit, export)
+	}
+}
@@ -0,0 +1,117 @@
+package consul
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Listing of one path as of a Consul index
+type cachedList struct {
+	Index uint64
+	Pairs consulapi.KVPairs
+}
+
+// --cache-file content, raw listings per queried path of one server as
+// seen by one set of credentials
+type kvCache struct {
+	Addr     string
+	Identity string
+	Lists    map[string]cachedList
+}
+
+// Hash of what decides which keys a listing returns besides the path: the
+// tokens and the default datacenter and namespace. Another token may get
+// the same index back but not be allowed to read the cached values.
+func cacheIdentity() string {
+	pathTokens := append([]string(nil), viper.GetStringSlice("path-token")...)
+	sort.Strings(pathTokens)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00", viper.GetString("token"), viper.GetString("fallback-token"), viper.GetString("datacenter"), viper.GetString("namespace"))
+	fmt.Fprintf(h, "%s", strings.Join(pathTokens, "\x00"))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Read the cache, empty if missing, unreadable or for another server than
+// addr or another set of credentials
+func loadCache(file string, addr string) *kvCache {
+	identity := cacheIdentity()
+	cache := &kvCache{Addr: addr, Identity: identity, Lists: map[string]cachedList{}}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return cache
+	}
+	var stored kvCache
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Addr != addr || stored.Identity != identity || stored.Lists == nil {
+		if viper.GetBool("verbose") {
+			fmt.Fprintln(os.Stderr, "Ignoring cache", file)
+		}
+		return cache
+	}
+	return &stored
+}
+
+func (c *kvCache) save(file string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data, 0600)
+}
+
+// List kv pairs under qp, reusing the cached listing when the index of the
+// prefix did not move. The index is checked with a keys query limited to
+// the first level, so an unchanged path is not downloaded again.
+func (c *kvCache) list(ctx context.Context, consul *consulapi.Client, qp queryPath) (consulapi.KVPairs, error) {
+	cached, ok := c.Lists[qp.String()]
+	if ok {
+		start := time.Now()
+		var qm *consulapi.QueryMeta
+		err := withFallback(ctx, qp, func(opts *consulapi.QueryOptions) error {
+			var err error
+			_, qm, err = consul.KV().Keys(qp.path, keySeparator(), opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if qm.LastIndex == cached.Index {
+			runTimings.record("cache", qp.String(), start, len(cached.Pairs))
+			return cached.Pairs, nil
+		}
+	}
+
+	start := time.Now()
+	var kvPairs consulapi.KVPairs
+	var qm *consulapi.QueryMeta
+	err := withFallback(ctx, qp, func(opts *consulapi.QueryOptions) error {
+		var err error
+		kvPairs, qm, err = consul.KV().List(qp.path, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	runTimings.record("list", qp.String(), start, len(kvPairs))
+
+	// Copy, fetchEnv rewrites values in place
+	pairs := make(consulapi.KVPairs, len(kvPairs))
+	for i, kvPair := range kvPairs {
+		pair := *kvPair
+		pair.Value = append([]byte(nil), kvPair.Value...)
+		pairs[i] = &pair
+	}
+	c.Lists[qp.String()] = cachedList{Index: qm.LastIndex, Pairs: pairs}
+	return kvPairs, nil
+}
@@ -0,0 +1,113 @@
+package consul
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestListCached(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1")
+	file := filepath.Join(t.TempDir(), "cache.json")
+	viper.Set("token", "primary")
+
+	// Each step lists app through the cache file left by the previous one
+	steps := []struct {
+		name      string
+		before    func()
+		wantLists int // full listings downloaded by this step
+		wantValue string
+	}{
+		{name: "first run misses", wantLists: 1, wantValue: "1"},
+		{name: "unchanged index hits", wantLists: 0, wantValue: "1"},
+		{name: "write moves the index", before: func() {
+			stub.mu.Lock()
+			stub.put("app/A", "2", 0)
+			stub.mu.Unlock()
+		}, wantLists: 1, wantValue: "2"},
+		{name: "hit after the refresh", wantLists: 0, wantValue: "2"},
+		{name: "other token misses", before: func() { viper.Set("token", "other") }, wantLists: 1, wantValue: "2"},
+		{name: "corrupt cache misses", before: func() { ioutil.WriteFile(file, []byte("{"), 0600) }, wantLists: 1, wantValue: "2"},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		lists := stub.count("list")
+
+		var failed []string
+		got, err := listCached(context.Background(), stub.client(), []queryPath{parsePath("app")}, file, &failed)
+		if err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+		if n := stub.count("list") - lists; n != step.wantLists {
+			t.Errorf("%s: %d listings downloaded, want %d", step.name, n, step.wantLists)
+		}
+		if len(got) != 1 || len(got[0].kvPairs) != 1 || string(got[0].kvPairs[0].Value) != step.wantValue {
+			t.Errorf("%s: got %v, want app/A=%s", step.name, got, step.wantValue)
+		}
+	}
+}
+
+func TestCacheIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		value  interface{}
+		differ bool
+	}{
+		{name: "token", key: "token", value: "other", differ: true},
+		{name: "fallback token", key: "fallback-token", value: "fallback", differ: true},
+		{name: "datacenter", key: "datacenter", value: "eu", differ: true},
+		{name: "namespace", key: "namespace", value: "team-a", differ: true},
+		{name: "path token", key: "path-token", value: []string{"app=secret"}, differ: true},
+		{name: "unrelated flag", key: "verbose", value: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("token", "primary")
+			base := cacheIdentity()
+			viper.Set(tt.key, tt.value)
+			if differ := cacheIdentity() != base; differ != tt.differ {
+				t.Errorf("identity changed %v, want %v", differ, tt.differ)
+			}
+		})
+	}
+}
+
+// Servers at the same index do not share listings, the cache is keyed by
+// the address of the client listing it
+func TestCachePerServer(t *testing.T) {
+	resetConfig(t)
+	file := filepath.Join(t.TempDir(), "cache.json")
+	eu := newConsulStub(t, "app/A", "eu")
+	us := newConsulStub(t, "app/A", "us")
+
+	for _, stub := range []*consulStub{eu, us, eu} {
+		var failed []string
+		got, err := listCached(context.Background(), stub.client(), []queryPath{parsePath("app")}, file, &failed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := stub.value("app/A"); len(got) != 1 || string(got[0].kvPairs[0].Value) != want {
+			t.Errorf("listing of %s = %v, want app/A=%s", stub.addr(), got, want)
+		}
+	}
+	if eu.count("list") != 2 || us.count("list") != 1 {
+		t.Errorf("%d and %d listings downloaded, want 2 and 1", eu.count("list"), us.count("list"))
+	}
+}
+
+func TestCacheFileWithClusters(t *testing.T) {
+	resetConfig(t)
+	viper.Set("cache-file", "cache.json")
+	viper.Set("cluster", []string{"eu=eu:8500", "us=us:8500"})
+	if err := CheckListFlags(); err == nil {
+		t.Error("--cache-file with --cluster accepted")
+	}
+}
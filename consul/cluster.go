@@ -0,0 +1,183 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Placeholder in --output-file and --emit paths replaced by the cluster name
+const clusterPlaceholder = "{cluster}"
+
+// Cluster names end up in variable names and file paths
+var clusterNamePattern = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+type cluster struct {
+	name string
+	addr string
+}
+
+// Prefix of the cluster's variables in labeled output, the upper cased name
+// with - replaced by _
+func (c cluster) label() string {
+	return strings.ToUpper(strings.Replace(c.name, "-", "_", -1)) + "_"
+}
+
+// Parse --cluster name=addr definitions
+func parseClusters() ([]cluster, error) {
+	var clusters []cluster
+	labels := map[string]string{}
+	for _, spec := range viper.GetStringSlice("cluster") {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid --cluster %q, expected name=addr", spec)
+		}
+		c := cluster{name: parts[0], addr: parts[1]}
+		if !clusterNamePattern.MatchString(c.name) {
+			return nil, fmt.Errorf("Invalid --cluster name %q, expected letters, digits, - and _", c.name)
+		}
+		if other, ok := labels[c.label()]; ok {
+			if other == c.name {
+				return nil, fmt.Errorf("Duplicate --cluster name %q", c.name)
+			}
+			return nil, fmt.Errorf("--cluster names %q and %q both label variables %s", other, c.name, c.label())
+		}
+		labels[c.label()] = c.name
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+// GetClusters fetches the same paths from every --cluster. Output paths
+// containing {cluster} get one unlabeled file per cluster. Otherwise JSON
+// output is an object keyed by cluster name, and every other format
+// prefixes variable names with NAME_. The --manifest and summary are written
+// once, for the variables of all clusters labeled.
+func GetClusters(ctx context.Context) {
+	clusters, err := parseClusters()
+	if err != nil {
+		fail(1, "", "%s", err)
+	}
+	emits, err := parseEmits()
+	if err != nil {
+		fail(1, "", "%s", err)
+	}
+
+	perFile := strings.Contains(viper.GetString("output-file"), clusterPlaceholder)
+	for _, e := range emits {
+		perFile = perFile || strings.Contains(e.file, clusterPlaceholder)
+	}
+
+	var snaps []*snapshot
+	var failed []string
+	for _, c := range clusters {
+		if viper.GetBool("verbose") {
+			fmt.Fprintln(os.Stderr, "Fetching from cluster", c.name)
+		}
+		consul := connectAddr(ctx, c.addr)
+		f, err := fetchEnv(ctx, consul)
+		if err != nil {
+			exitOnCancel(ctx)
+			fail(133, "", "%s: %s", c.name, err)
+		}
+		for _, path := range f.failed {
+			failed = append(failed, c.name+":"+path)
+		}
+		snap := processEnv(f)
+		audit(ctx, consul, snap)
+
+		if perFile {
+			outs := renderOutputs(snap)
+			for i := range outs {
+				outs[i].file = strings.Replace(outs[i].file, clusterPlaceholder, c.name, -1)
+			}
+			writeFiles(snap, outs)
+		}
+		snaps = append(snaps, snap)
+		if len(f.failed) == 0 {
+			saveState(c.addr, f.maxIndex)
+		}
+	}
+
+	labeled := labelClusters(clusters, snaps)
+	if !perFile {
+		if len(emits) == 0 && outputFormat() == "json" {
+			byCluster := make(map[string]map[string]string, len(clusters))
+			for i, c := range clusters {
+				byCluster[c.name] = snaps[i].env
+			}
+			j, err := marshalJSON(byCluster)
+			if err == nil {
+				err = writeOutput(viper.GetString("output-file"), append(j, '\n'), 0)
+			}
+			if err != nil {
+				fail(134, "", "Error writing output: %s", err)
+			}
+		} else {
+			writeFiles(labeled, renderOutputs(labeled))
+		}
+	}
+	writeReports(labeled)
+	runTimings.print()
+	failPartial(failed)
+}
+
+// Merge cluster snapshots into one with NAME_ prefixed variables. Folders
+// keep their names and hold the variables of every cluster, each variable
+// keeping the kv pair and address it was read from.
+func labelClusters(clusters []cluster, snaps []*snapshot) *snapshot {
+	labeled := &snapshot{
+		envMap:       map[string]map[string]*consulapi.KVPair{},
+		paths:        snaps[0].paths,
+		env:          map[string]string{},
+		secrets:      map[string]bool{},
+		sources:      map[string]string{},
+		winners:      map[string]*consulapi.KVPair{},
+		descriptions: map[string]map[string]string{},
+		encodings:    map[string]string{},
+		addrs:        map[string]string{},
+	}
+	for i, c := range clusters {
+		snap := snaps[i]
+		prefix := c.label()
+		for folder, pairs := range snap.envMap {
+			if _, ok := labeled.envMap[folder]; !ok {
+				labeled.envMap[folder] = map[string]*consulapi.KVPair{}
+			}
+			for k, kvPair := range pairs {
+				labeled.envMap[folder][prefix+k] = kvPair
+			}
+		}
+		for _, k := range snap.keys {
+			name := prefix + k
+			labeled.keys = append(labeled.keys, name)
+			labeled.env[name] = snap.env[k]
+			labeled.secrets[name] = snap.secrets[k]
+			labeled.sources[name] = snap.sources[k]
+			labeled.addrs[name] = c.addr
+			if kvPair, ok := snap.winners[k]; ok {
+				labeled.winners[name] = kvPair
+			}
+			if desc := snap.description(k); desc != "" {
+				if _, ok := labeled.descriptions[snap.sources[k]]; !ok {
+					labeled.descriptions[snap.sources[k]] = map[string]string{}
+				}
+				labeled.descriptions[snap.sources[k]][name] = desc
+			}
+		}
+		for key, encoding := range snap.encodings {
+			labeled.encodings[key] = encoding
+		}
+		labeled.skipped += snap.skipped
+		labeled.filtered += snap.filtered
+		if snap.maxIndex > labeled.maxIndex {
+			labeled.maxIndex = snap.maxIndex
+		}
+	}
+	return labeled
+}
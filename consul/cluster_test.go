@@ -0,0 +1,127 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseClusters(t *testing.T) {
+	tests := []struct {
+		specs   []string
+		labels  []string
+		wantErr bool
+	}{
+		{specs: []string{"eu=eu:8500", "us=us:8500"}, labels: []string{"EU_", "US_"}},
+		{specs: []string{"eu-west=eu:8500"}, labels: []string{"EU_WEST_"}},
+		{specs: []string{"eu"}, wantErr: true},
+		{specs: []string{"=eu:8500"}, wantErr: true},
+		{specs: []string{"eu/west=eu:8500"}, wantErr: true},
+		{specs: []string{"eu.west=eu:8500"}, wantErr: true},
+		{specs: []string{"eu=a:8500", "eu=b:8500"}, wantErr: true},
+		{specs: []string{"eu-west=a:8500", "EU_WEST=b:8500"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.specs, " "), func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("cluster", tt.specs)
+			clusters, err := parseClusters()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClusters(%q) error %v, want error %v", tt.specs, err, tt.wantErr)
+			}
+			for i, c := range clusters {
+				if c.label() != tt.labels[i] {
+					t.Errorf("label of %s = %q, want %q", c.name, c.label(), tt.labels[i])
+				}
+			}
+		})
+	}
+}
+
+// Two clusters with different values under the same keys
+func TestGetClusters(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(dir string)
+		files  map[string]string // output files and their content
+	}{
+		{
+			name: "labeled env",
+			config: func(dir string) {
+				viper.Set("output-file", filepath.Join(dir, "out"))
+			},
+			files: map[string]string{"out": "EU_WEST_HOST=\"eu\"\nEU_WEST_PORT=\"1\"\nUS_HOST=\"us\"\nUS_PORT=\"2\"\n"},
+		},
+		{
+			name: "labeled INI keeps both clusters in their folders",
+			config: func(dir string) {
+				viper.Set("ini", true)
+				viper.Set("output-file", filepath.Join(dir, "out"))
+			},
+			files: map[string]string{"out": "[DEFAULT]\nEU_WEST_HOST = eu\nUS_HOST = us\n\n[db]\nEU_WEST_PORT = 1\nUS_PORT = 2\n"},
+		},
+		{
+			name: "json object per cluster",
+			config: func(dir string) {
+				viper.Set("json", true)
+				viper.Set("output-file", filepath.Join(dir, "out"))
+			},
+			files: map[string]string{"out": `{"eu-west":{"HOST":"eu","PORT":"1"},"us":{"HOST":"us","PORT":"2"}}` + "\n"},
+		},
+		{
+			name: "file per cluster",
+			config: func(dir string) {
+				viper.Set("output-file", filepath.Join(dir, "{cluster}.env"))
+			},
+			files: map[string]string{
+				"eu-west.env": "HOST=\"eu\"\nPORT=\"1\"\n",
+				"us.env":      "HOST=\"us\"\nPORT=\"2\"\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			dir := t.TempDir()
+			eu := newConsulStub(t, "app/HOST", "eu", "app/db/PORT", "1")
+			us := newConsulStub(t, "app/HOST", "us", "app/db/PORT", "2")
+			viper.Set("cluster", []string{"eu-west=" + eu.addr(), "us=" + us.addr()})
+			viper.Set("path", []string{"app", "app/db"})
+			manifest := filepath.Join(dir, "manifest.json")
+			viper.Set("manifest", manifest)
+			tt.config(dir)
+
+			captureStderr(t, func() { GetClusters(context.Background()) })
+
+			for name, want := range tt.files {
+				data, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s =\n%s\nwant\n%s", name, data, want)
+				}
+			}
+
+			// One manifest for all clusters, each entry with its own server
+			data, err := ioutil.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entries map[string]manifestEntry
+			if err := json.Unmarshal(data, &entries); err != nil {
+				t.Fatal(err)
+			}
+			for name, addr := range map[string]string{"EU_WEST_HOST": eu.addr(), "EU_WEST_PORT": eu.addr(), "US_HOST": us.addr(), "US_PORT": us.addr()} {
+				if entries[name].Address != addr || entries[name].Key == "" {
+					t.Errorf("manifest entry of %s = %+v, want a key read from %s", name, entries[name], addr)
+				}
+			}
+		})
+	}
+}
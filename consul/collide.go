@@ -0,0 +1,20 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error when names differ only by case, as they would overwrite each other
+// on case-insensitive filesystems or parsers
+func caseCollisions(what string, names []string) error {
+	seen := map[string]string{}
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if other, ok := seen[lower]; ok && other != name {
+			return fmt.Errorf("%s %q and %q differ only by case", what, other, name)
+		}
+		seen[lower] = name
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCaseCollisions(t *testing.T) {
+	tests := []struct {
+		names   []string
+		wantErr bool
+	}{
+		{names: []string{"Foo", "Bar", "Foo"}},
+		{names: []string{"Foo", "bar", "foo"}, wantErr: true},
+		{names: []string{"FOO", "Foo"}, wantErr: true},
+		{names: nil},
+	}
+	for _, tt := range tests {
+		if err := caseCollisions("variables", tt.names); (err != nil) != tt.wantErr {
+			t.Errorf("caseCollisions(%q) = %v, want error %v", tt.names, err, tt.wantErr)
+		}
+	}
+}
+
+// Sibling Foo and foo keys keep the first in sorted order with a warning,
+// or fail with --strict. Runs in a child process, as failing exits.
+func TestCaseCollisionKeys(t *testing.T) {
+	if os.Getenv("CONSULENV_TEST_COLLISION") != "" {
+		viper.Set("path", []string{"app"})
+		viper.Set("strict", true)
+		processEnv(newFetched(map[string]map[string]string{"app": {"Foo": "1", "foo": "2"}}))
+		os.Exit(0)
+	}
+
+	resetConfig(t)
+	viper.Set("path", []string{"app", "app/db"})
+	var snap *snapshot
+	out := captureStderr(t, func() {
+		snap = processEnv(newFetched(map[string]map[string]string{"app": {"Foo": "1", "foo": "2"}, "app/db": {"FOO": "3"}}))
+	})
+	if want := map[string]string{"Foo": "1"}; !reflect.DeepEqual(snap.env, want) {
+		t.Errorf("env %q, want %q", snap.env, want)
+	}
+	if strings.Count(out, "Case collision") != 2 {
+		t.Errorf("stderr %q, want both collisions reported", out)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCaseCollisionKeys$")
+	cmd.Env = append(os.Environ(), "CONSULENV_TEST_COLLISION=1")
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 135 {
+		t.Fatalf("strict collision exited with %v, want 135: %s", err, output)
+	}
+	if !strings.Contains(string(output), "differ only by case") {
+		t.Errorf("output %q, want the collision", output)
+	}
+}
+
+// Folders Foo and foo would both be INI sections
+func TestCaseCollisionSections(t *testing.T) {
+	resetConfig(t)
+	viper.Set("path", []string{"app", "app/Foo", "app/foo"})
+	f := newFetched(map[string]map[string]string{"app": {"A": "1"}, "app/Foo": {"B": "2"}, "app/foo": {"C": "3"}})
+
+	var b strings.Builder
+	err := renderINI(&b, processEnv(f))
+	if err == nil || !strings.Contains(err.Error(), `INI sections "Foo" and "foo" differ only by case`) {
+		t.Errorf("renderINI error %v, want the section collision", err)
+	}
+}
+
+// Names differing only by case across the merge keep a deterministic
+// winner: the first name in sorted order within a path, the path of higher
+// precedence across paths. Identical names are plain precedence.
+func TestCaseCollisionMerge(t *testing.T) {
+	tests := []struct {
+		name       string
+		folders    map[string]map[string]string
+		want       map[string]string
+		collisions int
+	}{
+		{
+			name:       "one path",
+			folders:    map[string]map[string]string{"app": {"Port": "1", "PORT": "2", "port": "3"}},
+			want:       map[string]string{"PORT": "2"},
+			collisions: 2,
+		},
+		{
+			name:       "across paths",
+			folders:    map[string]map[string]string{"app": {"port": "1"}, "common": {"PORT": "2", "HOST": "h"}},
+			want:       map[string]string{"port": "1", "HOST": "h"},
+			collisions: 1,
+		},
+		{
+			name:    "same name across paths",
+			folders: map[string]map[string]string{"app": {"PORT": "1"}, "common": {"PORT": "2"}},
+			want:    map[string]string{"PORT": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("path", []string{"app", "common"})
+			var snap *snapshot
+			out := captureStderr(t, func() { snap = processEnv(newFetched(tt.folders)) })
+			if !reflect.DeepEqual(snap.env, tt.want) {
+				t.Errorf("env %q, want %q", snap.env, tt.want)
+			}
+			if got := strings.Count(out, "Case collision"); got != tt.collisions {
+				t.Errorf("%d collisions reported, want %d: %s", got, tt.collisions, out)
+			}
+		})
+	}
+}
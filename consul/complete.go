@@ -0,0 +1,36 @@
+package consul
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Consul folders starting with partial, for shell completion of --path.
+// Invalid connection settings, connection and query errors yield no
+// completions, never output or a password prompt.
+func CompletePaths(ctx context.Context, partial string) []string {
+	consul, err := buildClient(viper.GetString("addr"), false)
+	if err != nil {
+		return nil
+	}
+
+	qualifier := qualifierPattern.FindString(partial)
+	qp := parsePath(qualifier)
+	prefix := strings.TrimLeft(strings.TrimPrefix(partial, qualifier), "/")
+
+	sep := keySeparator()
+	keys, _, err := consul.KV().Keys(prefix, sep, qp.options(ctx))
+	if err != nil {
+		return nil
+	}
+
+	var folders []string
+	for _, k := range keys {
+		if strings.HasSuffix(k, sep) {
+			folders = append(folders, qualifier+k)
+		}
+	}
+	return folders
+}
@@ -0,0 +1,49 @@
+package consul
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCompletePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  func(addr string)
+		partial string
+		want    []string
+	}{
+		{name: "folders only", partial: "app/", want: []string{"app/db/"}},
+		{name: "qualified", partial: "dc=eu:app/", want: []string{"dc=eu:app/db/"}},
+		{name: "invalid address", config: func(string) { viper.Set("addr", "ftp://consul") }, partial: "app/"},
+		{name: "conflicting auth", config: func(string) {
+			viper.Set("auth", "user:pass")
+			viper.Set("auth-user", "user")
+		}, partial: "app/"},
+		// Would prompt on a terminal outside completion
+		{name: "auth password not in a file", config: func(string) { viper.Set("auth-user", "user") }, partial: "app/"},
+		{name: "unreachable", config: func(string) { viper.Set("addr", "127.0.0.1:1") }, partial: "app/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "app/A", "1", "app/db/B", "2")
+			viper.Set("addr", stub.addr())
+			viper.Set("verbose", true)
+			if tt.config != nil {
+				tt.config(stub.addr())
+			}
+
+			var got []string
+			out := captureStderr(t, func() { got = CompletePaths(context.Background(), tt.partial) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompletePaths(%q) = %q, want %q", tt.partial, got, tt.want)
+			}
+			if out != "" {
+				t.Errorf("completion printed %q", out)
+			}
+		})
+	}
+}
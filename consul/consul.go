@@ -1,14 +1,22 @@
 package consul
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	pathpkg "path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	consulapi "github.com/hashicorp/consul/api"
 	"github.com/spf13/viper"
@@ -29,46 +37,168 @@ func (s ByLength) Less(i, j int) bool {
 }
 
 func getConsul() *consulapi.Client {
-	addr := viper.GetString("addr")
+	return consulClient(viper.GetString("addr"))
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]*consulapi.Client{}
+)
+
+// Client for the server at addr, with all other connection settings from
+// the configuration. Clients are built once per address and reused, so
+// --poll cycles and retries keep their pooled connections.
+func consulClient(addr string) *consulapi.Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[addr]; ok {
+		return client
+	}
+	client := newConsulClient(addr)
+	clients[addr] = client
+	return client
+}
+
+// Address consul was built for by consulClient, --addr for other clients
+func clientAddr(consul *consulapi.Client) string {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	for addr, client := range clients {
+		if client == consul {
+			return addr
+		}
+	}
+	return viper.GetString("addr")
+}
+
+func newConsulClient(addr string) *consulapi.Client {
+	consul, err := buildClient(addr, true)
+	if err != nil {
+		e := err.(*Error)
+		fail(e.Code, "", "%s", e.Message)
+	}
+	return consul
+}
+
+// Client for addr, or the *Error to exit with when the connection settings
+// are invalid. Unless interactive, nothing is printed and a missing auth
+// password is an error instead of a prompt.
+func buildClient(addr string, interactive bool) (*consulapi.Client, error) {
 	token := viper.GetString("token")
 	auth := viper.GetString("auth")
+	authUser := viper.GetString("auth-user")
 	ssl := viper.GetString("ssl")
 
 	verbose := viper.GetBool("verbose")
 
-	if verbose {
-		fmt.Printf("Connecting to %s %s %s %s\n", addr, token, auth, ssl)
+	if verbose && interactive {
+		fmt.Fprintf(os.Stderr, "Connecting to %s token %s auth %s ssl %s\n", addr, redactSecret(token), redactSecret(auth), ssl)
 	}
 	config := consulapi.DefaultConfig()
-	config.Address = addr
+	host, scheme, socket, err := parseAddr(addr, ssl == "true")
+	if err != nil {
+		return nil, &Error{Code: 1, Message: err.Error()}
+	}
+	config.Address = host
+	config.Scheme = scheme
 
-	if ssl == "true" {
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+	transport := &http.Transport{}
+	if socket != "" {
+		transport.DialContext = unixDialer(socket)
+	}
+	if scheme == "https" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if socket != "" || scheme == "https" {
 		config.HttpClient = &http.Client{Transport: transport}
-		config.Scheme = "https"
-	} else {
-		config.Scheme = "http"
+	}
+
+	if auth != "" && authUser != "" {
+		return nil, &Error{Code: 132, Message: "Use either --auth or --auth-user, not both."}
+	}
+
+	passwordFile := viper.GetString("auth-password-file")
+	if authUser == "" && passwordFile != "" {
+		return nil, &Error{Code: 132, Message: "--auth-password-file requires --auth-user."}
 	}
 
 	if auth != "" {
 		sliceAuth := strings.Split(auth, ":")
 		if len(sliceAuth) != 2 {
-			fmt.Fprintln(os.Stderr, "Invalid AUTH string specified.")
-			os.Exit(132)
+			return nil, &Error{Code: 132, Message: "Invalid AUTH string specified."}
 		}
 		user := sliceAuth[0]
 		pass := sliceAuth[1]
 		config.HttpAuth = &consulapi.HttpBasicAuth{Username: user, Password: pass}
 	}
 
+	if authUser != "" {
+		if !interactive && (passwordFile == "" || passwordFile == "-") {
+			return nil, &Error{Code: 132, Message: "Unable to read auth password: no --auth-password-file"}
+		}
+		pass, err := readPassword(passwordFile)
+		if err != nil {
+			return nil, &Error{Code: 132, Message: fmt.Sprintf("Unable to read auth password: %s", err)}
+		}
+		config.HttpAuth = &consulapi.HttpBasicAuth{Username: authUser, Password: pass}
+	}
+
 	if token != "" {
 		config.Token = token
 	}
 
 	consul, _ := consulapi.NewClient(config)
-	return consul
+	return consul, nil
+}
+
+// Host and scheme to reach addr at, and the socket to dial for unix://
+// addresses. The scheme of a full http(s):// URL is authoritative, --ssl
+// only picks it for a bare host:port or a socket.
+func parseAddr(addr string, ssl bool) (host string, scheme string, socket string, err error) {
+	scheme = "http"
+	if ssl {
+		scheme = "https"
+	}
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		// Host is only used for the HTTP request line, dialing goes to the socket
+		return "consul", scheme, strings.TrimPrefix(addr, "unix://"), nil
+	case strings.Contains(addr, "://"):
+		u, err := url.Parse(addr)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return "", "", "", fmt.Errorf("Invalid --addr %q, expected host:port or an http(s):// URL.", addr)
+		}
+		return u.Host, u.Scheme, "", nil
+	}
+	return addr, scheme, "", nil
+}
+
+// Hide credentials in diagnostics, only telling whether one is set
+func redactSecret(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return "<redacted>"
+}
+
+// Dial the unix socket regardless of the requested network address
+func unixDialer(path string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+}
+
+// Query options bound to ctx, so cancelling it aborts in-flight requests
+func queryOptions(ctx context.Context) *consulapi.QueryOptions {
+	return globalQueryOptions(&consulapi.QueryOptions{}).WithContext(ctx)
+}
+
+// Exit quietly when a failure was caused by cancellation (e.g. Ctrl-C)
+func exitOnCancel(ctx context.Context) {
+	if ctx.Err() != nil {
+		fail(130, "", "Interrupted.")
+	}
 }
 
 func contains(s []string, e string) bool {
@@ -90,13 +220,71 @@ func pathIsUnique(s []string, path string) bool {
 	return true
 }
 
+// Check if folder is the queried path itself or lives below it
+func inPath(folder string, path string) bool {
+	return path == "" || folder == path || strings.HasPrefix(folder, path+keySeparator())
+}
+
+// Folder name relative to --relative-to when folder lives below it,
+// otherwise relative to the queried path the folder was fetched from
+func relativeFolder(folder string, path string) string {
+	base := strings.Trim(viper.GetString("relative-to"), "/")
+	if base == "" || !inPath(folder, base) {
+		base = path
+	}
+	return strings.Trim(strings.TrimPrefix(folder, base), "/"+keySeparator())
+}
+
+// Pattern from patterns excluding key, or empty. Glob patterns match the key
+// or any of its parent folders, plain patterns match as a path prefix.
+func excludedBy(key string, patterns []string) string {
+	key = strings.Trim(key, "/")
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		if strings.ContainsAny(pattern, "*?[") {
+			parts := strings.Split(key, "/")
+			for i := 1; i <= len(parts); i++ {
+				if ok, _ := pathpkg.Match(pattern, strings.Join(parts[:i], "/")); ok {
+					return pattern
+				}
+			}
+		} else if inPath(key, pattern) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// Check if variable name k equals or matches any of the globs
+func matchesName(k string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := pathpkg.Match(pattern, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Separator between folders and variable name in Consul keys
+func keySeparator() string {
+	if sep := viper.GetString("key-separator"); sep != "" {
+		return sep
+	}
+	return "/"
+}
+
 func pathsToQuery(paths []string) []string {
+	var normalized []string
+	for _, path := range paths {
+		normalized = append(normalized, normalizePath(path))
+	}
+	paths = normalized
+
 	sort.Sort(ByLength(paths))
 
 	var uniquePaths []string
 
 	for _, path := range paths {
-		path = strings.Trim(path, "/")
 		if pathIsUnique(paths, path) && !contains(uniquePaths, path) {
 			uniquePaths = append(uniquePaths, path)
 		}
@@ -105,128 +293,826 @@ func pathsToQuery(paths []string) []string {
 	return uniquePaths
 }
 
-func processEnv(envMap map[string]map[string]string, envKeys []string) {
-	paths := viper.GetStringSlice("path")
-	export := viper.GetBool("export")
-	jsonExport := viper.GetBool("json")
+// Merge folders into a flat variable set, earlier paths take precedence
+func processEnv(f *fetched) *snapshot {
+	envMap := f.envMap
+	paths := Paths()
+	secretFlag := viper.GetUint64("secret-flag")
+	sortBy := viper.GetString("sort-by")
+	selectFile := viper.GetString("select-file")
+	skipEmpty := viper.GetBool("skip-empty")
+	stripPrefix := viper.GetString("strip-value-prefix")
+	stripKeys := viper.GetStringSlice("strip-value-keys")
+	valuePrefix := viper.GetString("value-prefix")
+	valueSuffix := viper.GetString("value-suffix")
+	segmentVar := viper.GetString("env-from-last-segment")
+	expand := viper.GetBool("expand-json")
+	expandNested := viper.GetBool("expand-json-nested")
+	require := viper.GetStringSlice("require")
+	onMissing := viper.GetString("on-missing-key")
+	baseline := viper.GetString("baseline")
+	overlay := viper.GetString("overlay")
+	limit := viper.GetInt("limit")
+	deepMerge := viper.GetBool("json-deep-merge")
+	failOnConflict := viper.GetBool("fail-on-conflict-across-namespaces")
+	overlayUnder := viper.GetBool("overlay-under")
+	naming := viper.GetString("naming")
+	fillOnly := viper.GetBool("fill-only")
+	fillEmpty := viper.GetBool("fill-empty")
+	strict := viper.GetBool("strict")
+	valueMatch := viper.GetString("value-match")
 	verbose := viper.GetBool("verbose")
 
+	whenRules, err := parseWhenRules()
+	if err != nil {
+		fail(1, "", "%s", err)
+	}
+	pipelines, err := parseValueFns()
+	if err != nil {
+		fail(1, "", "%s", err)
+	}
+	validateRules, err := parseValidateRules()
+	if err != nil {
+		fail(1, "", "%s", err)
+	}
+	nameTmpl, err := parseNameTemplate()
+	if err != nil {
+		fail(1, "", "%s", err)
+	}
+
 	var keys []string
 	env := make(map[string]string)
+	secrets := make(map[string]bool)
+	sources := make(map[string]string)
+	var trimmed []string
+	var conflicts []string
+	folded := map[string]string{}
+	winners := map[string]*consulapi.KVPair{}
 
 	for _, path := range paths {
-		path = strings.Trim(path, "/")
+		path = normalizePath(path)
+		trimmed = append(trimmed, path)
 		if _, ok := envMap[path]; ok {
-			for k, v := range envMap[path] {
-				if !contains(keys, k) {
-					keys = append(keys, k)
-					env[k] = v
+			var names []string
+			for k := range envMap[path] {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+
+			var pathKeys []string
+			for _, k := range names {
+				kvPair := envMap[path][k]
+				if nameTmpl != nil {
+					name, err := templateName(nameTmpl, path, k)
+					if err != nil {
+						fail(135, kvPair.Key, "%s", err)
+					}
+					if desc, ok := f.descriptions[path][k]; ok {
+						f.descriptions[path][name] = desc
+					}
+					k = name
+				}
+				// Names differing only by case would overwrite each other once
+				// upper cased or read on a case-insensitive system
+				if other, ok := folded[strings.ToLower(k)]; ok && other != k {
+					if strict {
+						fail(135, kvPair.Key, "%s from %s and %s from %s differ only by case", k, path, other, sources[other])
+					}
+					fmt.Fprintf(os.Stderr, "Case collision: %s from %s ignored, %s from %s wins\n", k, path, other, sources[other])
+					continue
+				}
+				folded[strings.ToLower(k)] = k
+
+				if _, taken := winners[k]; !taken && !contains(keys, k) {
+					pathKeys = append(pathKeys, k)
+					env[k] = string(kvPair.Value)
+					sources[k] = path
+					winners[k] = kvPair
+					if secretFlag != 0 && kvPair.Flags == secretFlag {
+						secrets[k] = true
+					}
+				} else {
+					if winner, ok := winners[k]; ok && scope(sources[k]) != scope(path) && string(winner.Value) != string(kvPair.Value) {
+						conflicts = append(conflicts, fmt.Sprintf("%s: %s wins over %s", k, sources[k], path))
+					}
+					if deepMerge {
+						// Lower precedence JSON objects fill in missing leaves
+						if merged, ok := mergeJSON(env[k], string(kvPair.Value)); ok {
+							env[k] = merged
+						}
+					}
 				}
 			}
+			sort.Strings(pathKeys)
+			keys = append(keys, pathKeys...)
+		}
+
+		// Synthetic variable holding the last path segment, real keys at the
+		// same path win over it
+		if segmentVar != "" && !contains(keys, segmentVar) {
+			segments := strings.Split(parsePath(path).path, keySeparator())
+			keys = append(keys, segmentVar)
+			env[segmentVar] = segments[len(segments)-1]
+			sources[segmentVar] = path
 		}
 	}
 
-	fi, _ := os.Stdout.Stat()
-	if jsonExport {
-		j, err := json.Marshal(env)
+	// Same name from another datacenter or namespace with another value
+	if len(conflicts) > 0 && (failOnConflict || verbose) {
+		sort.Strings(conflicts)
+		for _, conflict := range conflicts {
+			fmt.Fprintf(os.Stderr, "Conflict across namespaces: %s\n", conflict)
+		}
+		if failOnConflict {
+			fail(135, "", "%d conflicts across namespaces", len(conflicts))
+		}
+	}
+
+	// Local overrides win over Consul, or only fill gaps with --overlay-under
+	if overlay != "" {
+		overlayKeys, overlayEnv, err := parseDotenv(overlay)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating JSON: %s\n", err)
-		} else {
-			fmt.Println(string(j))
+			fail(1, "", "Error reading --overlay: %s", err)
+		}
+		for _, k := range overlayKeys {
+			if _, ok := env[k]; ok {
+				if overlayUnder {
+					continue
+				}
+				delete(secrets, k)
+				delete(winners, k)
+			} else {
+				keys = append(keys, k)
+			}
+			env[k] = overlayEnv[k]
+			sources[k] = overlay
 		}
-	} else {
+	}
+
+	if expand {
+		var expanded []string
+		for _, k := range keys {
+			fieldKeys, fieldEnv, ok := expandJSON(k, env[k], expandNested)
+			if !ok {
+				expanded = append(expanded, k)
+				continue
+			}
+			for _, fk := range fieldKeys {
+				// Explicitly defined variables win over expanded fields
+				if _, exists := env[fk]; exists || contains(expanded, fk) {
+					continue
+				}
+				expanded = append(expanded, fk)
+				env[fk] = fieldEnv[fk]
+				sources[fk] = sources[k]
+				secrets[fk] = secrets[k]
+				if kvPair, ok := winners[k]; ok {
+					winners[fk] = kvPair
+				}
+			}
+			// The object itself is no longer emitted
+			delete(env, k)
+			delete(sources, k)
+			delete(secrets, k)
+			delete(winners, k)
+		}
+		keys = expanded
+	}
+
+	if naming != "" {
+		if keys, err = applyNaming(naming, keys, env, secrets, sources, winners, f.descriptions); err != nil {
+			fail(135, "", "%s", err)
+		}
+	}
+
+	// Consul as a fallback, variables already in the environment are kept
+	if fillOnly {
+		var unsetKeys []string
+		for _, k := range keys {
+			if v, ok := os.LookupEnv(k); ok && (v != "" || !fillEmpty) {
+				if verbose {
+					fmt.Fprintf(os.Stderr, "%s already set, skipped by --fill-only\n", k)
+				}
+				delete(env, k)
+				continue
+			}
+			unsetKeys = append(unsetKeys, k)
+		}
+		keys = unsetKeys
+	}
+
+	if skipEmpty {
+		var nonEmpty []string
+		for _, k := range keys {
+			if strings.TrimSpace(env[k]) == "" {
+				delete(env, k)
+			} else {
+				nonEmpty = append(nonEmpty, k)
+			}
+		}
+		keys = nonEmpty
+	}
+
+	// Remove a stored prefix like "prod:", from the selected variables only
+	if stripPrefix != "" {
 		for _, k := range keys {
-			v := env[k]
-			var envLine string
-			if !strings.HasPrefix(v, "\"") && !strings.HasPrefix(v, "'") && !strings.HasSuffix(v, "\"") && !strings.HasSuffix(v, "'") {
-				v = fmt.Sprintf("\"%s\"", v)
+			if len(stripKeys) == 0 || matchesName(k, stripKeys) {
+				env[k] = strings.TrimPrefix(env[k], stripPrefix)
 			}
-			if export {
-				envLine = fmt.Sprintf("export %s=%s", k, v)
+		}
+	}
+
+	if err := applyValueFns(keys, env, pipelines); err != nil {
+		fail(135, "", "%s", err)
+	}
+
+	if len(whenRules) > 0 {
+		keys = applyWhenRules(keys, env, whenRules)
+	}
+
+	// Audits by value only log names, never the matched values, and mask
+	// secret-flagged and --redact-pattern values in what they output
+	if valueMatch != "" {
+		re, err := regexp.Compile(valueMatch)
+		if err != nil {
+			fail(1, "", "Invalid --value-match: %s", err)
+		}
+		var matched []string
+		for _, k := range keys {
+			if re.MatchString(env[k]) {
+				matched = append(matched, k)
+				if secrets[k] {
+					env[k] = maskedValue
+				}
+				env[k] = redact(env[k])
+				continue
+			}
+			if verbose {
+				fmt.Fprintf(os.Stderr, "%s skipped by --value-match\n", k)
+			}
+			delete(env, k)
+		}
+		keys = matched
+	}
+
+	if valuePrefix != "" || valueSuffix != "" {
+		for _, k := range keys {
+			env[k] = valuePrefix + env[k] + valueSuffix
+		}
+	}
+
+	if sortBy == "value" {
+		sort.SliceStable(keys, func(i, j int) bool {
+			if env[keys[i]] != env[keys[j]] {
+				return env[keys[i]] < env[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+	}
+
+	if selectFile != "" {
+		names, err := readNames(selectFile)
+		if err != nil {
+			fail(1, "", "Unable to read select file: %s", err)
+		}
+		var missing []string
+		keys, missing = selectKeys(keys, env, names)
+		for _, name := range missing {
+			fmt.Fprintf(os.Stderr, "Missing selected var: %s\n", name)
+		}
+		if len(missing) > 0 && !viper.GetBool("select-optional") {
+			fail(135, "", "Missing selected vars: %s", strings.Join(missing, ", "))
+		}
+		for k := range env {
+			if !contains(keys, k) {
+				delete(env, k)
+			}
+		}
+	}
+
+	if invalid := validateValues(keys, env, validateRules); len(invalid) > 0 {
+		for _, msg := range invalid {
+			fmt.Fprintf(os.Stderr, "Invalid value: %s\n", msg)
+		}
+		if strict {
+			fail(135, "", "%d values failed --validate", len(invalid))
+		}
+	}
+
+	var missing []string
+	for _, name := range require {
+		if _, ok := env[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range missing {
+		if onMissing == "" {
+			fmt.Fprintf(os.Stderr, "Missing required var: %s\n", name)
+		} else if err := runHook(onMissing, "MISSING_KEY="+name); err != nil {
+			fmt.Fprintf(os.Stderr, "on-missing-key command failed for %s: %s\n", name, err)
+		}
+	}
+	if len(missing) > 0 {
+		fail(135, "", "Missing required vars: %s", strings.Join(missing, ", "))
+	}
+
+	// Only emit what is new or changed against the baseline
+	var unset []string
+	if baseline != "" {
+		baseKeys, baseEnv, err := parseDotenv(baseline)
+		if err != nil {
+			fail(1, "", "Unable to read baseline: %s", err)
+		}
+		var changed []string
+		for _, k := range keys {
+			if v, ok := baseEnv[k]; ok && v == env[k] {
+				delete(env, k)
 			} else {
-				envLine = fmt.Sprintf("%s=%s", k, v)
+				changed = append(changed, k)
 			}
-			fmt.Printf("%s\n", envLine)
-			if verbose && (fi.Mode()&os.ModeCharDevice) == 0 {
-				fmt.Fprintf(os.Stderr, "%s\n", envLine)
+		}
+		keys = changed
+		if viper.GetBool("baseline-unset") {
+			for _, k := range baseKeys {
+				if _, ok := sources[k]; !ok {
+					unset = append(unset, k)
+				}
 			}
 		}
 	}
-	fmt.Fprintf(os.Stderr, "-- %d env variables loaded --\n", len(env))
+
+	if limit > 0 && len(keys) > limit {
+		fmt.Fprintf(os.Stderr, "Output truncated to %d of %d variables by --limit\n", limit, len(keys))
+		for _, k := range keys[limit:] {
+			delete(env, k)
+		}
+		keys = keys[:limit]
+	}
+
+	if verbose {
+		for _, k := range keys {
+			fmt.Fprintf(os.Stderr, "%s (from %s)\n", k, sources[k])
+		}
+	}
+
+	if viper.GetBool("scan-secrets") {
+		scanSecrets(keys, env)
+	}
+
+	return &snapshot{envMap: envMap, paths: trimmed, keys: keys, env: env, secrets: secrets, sources: sources, winners: winners, descriptions: f.descriptions, unset: unset, maxIndex: f.maxIndex, skipped: f.skipped, filtered: f.filtered, encodings: f.encodings}
+}
+
+type rendered struct {
+	emit
+	data []byte
 }
 
-func Keys() {
-	paths := viper.GetStringSlice("path")
+// Render the snapshot into every requested output
+func renderOutputs(snap *snapshot) []rendered {
+	outputFile := viper.GetString("output-file")
+
+	emits, _ := parseEmits()
+	if len(emits) == 0 {
+		emits = []emit{{format: outputFormat(), file: outputFile}}
+	}
+
+	var outs []rendered
+	for _, e := range emits {
+		var out bytes.Buffer
+		if err := renderers[e.format](&out, snap); err != nil {
+			fail(134, "", "Error rendering %s: %s", e.format, err)
+		}
+		outs = append(outs, rendered{emit: e, data: out.Bytes()})
+	}
+	return outs
+}
+
+func writeOutputs(snap *snapshot, outs []rendered) {
+	writeFiles(snap, outs)
+	writeReports(snap)
+}
+
+// Write the rendered outputs, or the --output-dir files instead
+func writeFiles(snap *snapshot, outs []rendered) {
 	verbose := viper.GetBool("verbose")
 
-	consul := getConsul()
+	if dir := viper.GetString("output-dir"); dir != "" {
+		if err := writeOutputDir(dir, snap); err != nil {
+			fail(134, "", "Error writing output: %s", err)
+		}
+		outs = nil
+	}
 
-	uniquePaths := pathsToQuery(paths)
+	fi, _ := os.Stdout.Stat()
+	for _, out := range outs {
+		if verbose && (out.format == "env" || out.format == "dotenv" || out.format == "export") && (out.file != "" || (fi.Mode()&os.ModeCharDevice) == 0) {
+			renderers[out.format](os.Stderr, snap.masked())
+		}
+		// Credentials stay private even when an existing file was readable
+		var perm os.FileMode
+		if out.format == "netrc" {
+			perm = 0600
+		}
+		if err := writeOutput(out.file, out.data, perm); err != nil {
+			fail(134, "", "Error writing output: %s", err)
+		}
+	}
+}
 
-	kv := consul.KV()
+// Write the --manifest and the load summary of snap
+func writeReports(snap *snapshot) {
+	if manifest := viper.GetString("manifest"); manifest != "" {
+		if err := writeManifest(manifest, snap); err != nil {
+			fail(134, "", "Error writing manifest: %s", err)
+		}
+	}
+	if viper.GetString("summary-format") == "json" {
+		if err := writeSummary(viper.GetString("summary-file"), snap); err != nil {
+			fail(134, "", "Error writing summary: %s", err)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "-- %d env variables loaded --\n", len(snap.env))
+}
 
-	for _, p := range uniquePaths {
-		if verbose {
-			fmt.Fprintln(os.Stderr, "Looking at", p)
+// Folders counted at the same time by --counts
+const countConcurrency = 8
+
+// Add a " (N keys)" suffix to each folder, counting all keys below it.
+// Folders are counted concurrently, at most countConcurrency at a time.
+func keyCounts(ctx context.Context, kv *consulapi.KV, qp queryPath, keyPaths []string, sep string) []string {
+	counted := make([]string, len(keyPaths))
+	errs := make([]error, len(keyPaths))
+	sem := make(chan struct{}, countConcurrency)
+
+	var wg sync.WaitGroup
+	for i, keyPath := range keyPaths {
+		if !strings.HasSuffix(keyPath, sep) {
+			counted[i] = keyPath
+			continue
 		}
-		keyPaths, qm, err := kv.Keys(p+"/", "/", nil)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err, qm)
-			os.Exit(133)
-		} else {
-			for _, keyPath := range keyPaths {
-				fmt.Println(keyPath)
+		wg.Add(1)
+		go func(i int, keyPath string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			keys, _, err := kv.Keys(keyPath, "", qp.options(ctx))
+			if err != nil {
+				errs[i] = err
+				return
 			}
+			runTimings.record("count", keyPath, start, len(keys))
+			counted[i] = fmt.Sprintf("%s (%d keys)", keyPath, len(keys))
+		}(i, keyPath)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			exitOnCancel(ctx)
+			fail(133, "", "%s", err)
 		}
 	}
+	return counted
 }
 
-func Get() {
-	paths := viper.GetStringSlice("path")
+// Keys lists the keys and folders directly under each path, sorted
+// across all paths, or per path in query order with --group-by-path
+func Keys(ctx context.Context) {
+	paths := Paths()
+	sep := keySeparator()
+	groupByPath := viper.GetBool("group-by-path")
+	withCounts := viper.GetBool("counts")
 	verbose := viper.GetBool("verbose")
 
-	consul := getConsul()
+	consul := connect(ctx)
 
-	uniquePaths := pathsToQuery(paths)
+	// Paths to list in precedence order, pathsToQuery sorts them by length
+	unique := pathsToQuery(paths)
+	var uniquePaths []string
+	for _, p := range paths {
+		if p = normalizePath(p); contains(unique, p) && !contains(uniquePaths, p) {
+			uniquePaths = append(uniquePaths, p)
+		}
+	}
 
 	kv := consul.KV()
 
-	envMap := map[string]map[string]string{}
-	envKeys := []string{}
-
+	var all []string
 	for _, p := range uniquePaths {
 		if verbose {
 			fmt.Fprintln(os.Stderr, "Looking at", p)
 		}
-		kvPairs, qm, err := kv.List(p, nil)
+		qp := parsePath(p)
+		start := time.Now()
+		keyPaths, qm, err := kv.Keys(qp.path+sep, sep, qp.options(ctx))
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err, qm)
-			os.Exit(133)
+			exitOnCancel(ctx)
+			fail(133, "", "%s %v", err, qm)
 		} else {
-			for _, kvPair := range kvPairs {
-				val := string(kvPair.Value)
-
-				parts := strings.Split(kvPair.Key, "/")
-				folder := strings.Join(parts[:len(parts)-1], "/")
-				folder = strings.Trim(folder, "/")
-				varName := parts[len(parts)-1]
-
-				if varName != "" {
-					if ok, _ := regexp.MatchString("^[A-Za-z0-9_]*$", varName); !ok {
-						fmt.Fprintf(os.Stderr, "Invalid var: %s\n", varName)
-					} else {
-						if _, ok := envMap[folder]; !ok {
-							envMap[folder] = make(map[string]string)
-						}
-						envMap[folder][varName] = val
-						if !contains(envKeys, varName) {
-							envKeys = append([]string{varName}, envKeys...)
+			runTimings.record("keys", qp.String(), start, len(keyPaths))
+			if withCounts {
+				keyPaths = keyCounts(ctx, kv, qp, keyPaths, sep)
+			}
+			if groupByPath {
+				for _, keyPath := range keyPaths {
+					fmt.Println(keyPath)
+				}
+			} else {
+				all = append(all, keyPaths...)
+			}
+		}
+	}
+
+	sort.Strings(all)
+	for _, keyPath := range all {
+		fmt.Println(keyPath)
+	}
+
+	runTimings.print()
+}
+
+// Invalid variable names listed in the summary, all of them with --verbose
+const maxInvalidListed = 5
+
+// Sidecar key suffix holding a human description of the key it belongs to
+const descriptionSuffix = ".desc"
+
+// Result of listing the queried paths, before merge
+type fetched struct {
+	envMap       map[string]map[string]*consulapi.KVPair // kv pairs per Consul folder
+	envKeys      []string
+	descriptions map[string]map[string]string // --with-descriptions text per folder and key
+	maxIndex     uint64                       // highest ModifyIndex listed, before filtering
+	skipped      int                          // keys skipped for invalid names
+	filtered     int                          // keys dropped by index, flags, exclusion or size
+	encodings    map[string]string            // --binary-as encoding per full key
+	failed       []string                     // paths skipped by --best-effort
+}
+
+// Check if none of the queried paths holds any variable
+func (f *fetched) empty() bool {
+	for _, path := range Paths() {
+		if len(f.envMap[normalizePath(path)]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func fetchEnv(ctx context.Context, consul *consulapi.Client) (*fetched, error) {
+	paths := Paths()
+	excludePaths := viper.GetStringSlice("exclude-path")
+	withDescriptions := viper.GetBool("with-descriptions")
+	maxValueSize := viper.GetInt("max-value-size")
+	validateUTF8 := viper.GetBool("validate-utf8")
+	replaceInvalid := viper.GetBool("replace-invalid")
+	warnEmptyDirs := viper.GetBool("warn-empty-dirs")
+	normalizeEOL := viper.GetBool("normalize-eol")
+	stripTrailingCR := viper.GetBool("strip-trailing-cr")
+	resolve := viper.GetBool("resolve-services")
+	sinceIndex := viper.GetUint64("modified-since-index")
+	if sinceIndex == 0 {
+		sinceIndex = stateIndex(clientAddr(consul))
+	}
+	flagsFilter := map[uint64]bool{}
+	for _, v := range viper.GetStringSlice("flags-filter") {
+		flags, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			fail(1, "", "Invalid --flags-filter %q, expected a number", v)
+		}
+		flagsFilter[flags] = true
+	}
+	binaryAs := viper.GetString("binary-as")
+	if binaryAs != "" && binaryAs != "hex" && binaryAs != "base64" {
+		fail(1, "", "Invalid --binary-as %q, expected hex or base64", binaryAs)
+	}
+	strict := viper.GetBool("strict")
+	sep := keySeparator()
+	verbose := viper.GetBool("verbose")
+	// The sidecar key would be split into another folder and never match
+	if withDescriptions && strings.Contains(descriptionSuffix, sep) {
+		fail(1, "", "--with-descriptions can not be used with --key-separator %q", sep)
+	}
+
+	uniquePaths := pathsToQuery(paths)
+
+	envMap := map[string]map[string]*consulapi.KVPair{}
+	envKeys := []string{}
+	descriptions := map[string]map[string]string{}
+	excluded := map[string]int{}
+	var markers []string
+	markerFolders := map[string]string{}
+	services := map[string]string{}
+	var maxIndex uint64
+	var invalid []string
+	var filtered int
+	encodings := map[string]string{}
+
+	lists, failed, err := listPaths(ctx, consul, uniquePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, list := range lists {
+		for _, kvPair := range list.kvPairs {
+			if kvPair.ModifyIndex > maxIndex {
+				maxIndex = kvPair.ModifyIndex
+			}
+			if kvPair.ModifyIndex <= sinceIndex {
+				filtered++
+				continue
+			}
+			if len(flagsFilter) > 0 && !flagsFilter[kvPair.Flags] {
+				filtered++
+				continue
+			}
+
+			if pattern := excludedBy(kvPair.Key, excludePaths); pattern != "" {
+				excluded[pattern]++
+				filtered++
+				continue
+			}
+
+			if maxValueSize > 0 && len(kvPair.Value) > maxValueSize {
+				if strict {
+					fail(135, kvPair.Key, "Value too large: %s (%d bytes, max %d)", kvPair.Key, len(kvPair.Value), maxValueSize)
+				}
+				fmt.Fprintf(os.Stderr, "Value too large: %s (%d bytes, max %d)\n", kvPair.Key, len(kvPair.Value), maxValueSize)
+				filtered++
+				continue
+			}
+
+			// Binary values survive as text, recorded for the --manifest
+			if binaryAs != "" && !utf8.Valid(kvPair.Value) {
+				kvPair.Value = []byte(encodeBinary(binaryAs, kvPair.Value))
+				encodings[kvPair.Key] = binaryAs
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Binary value %s encoded as %s\n", kvPair.Key, binaryAs)
+				}
+			}
+
+			if (validateUTF8 || replaceInvalid) && !utf8.Valid(kvPair.Value) {
+				if strict {
+					fail(135, kvPair.Key, "Invalid UTF-8: %s", kvPair.Key)
+				}
+				fmt.Fprintf(os.Stderr, "Invalid UTF-8: %s\n", kvPair.Key)
+				if replaceInvalid {
+					kvPair.Value = []byte(strings.ToValidUTF8(string(kvPair.Value), "\uFFFD"))
+				}
+			}
+
+			// Trailing CRs go first, so normalizing does not turn them into
+			// trailing newlines
+			if stripTrailingCR {
+				kvPair.Value = bytes.TrimRight(kvPair.Value, "\r")
+			}
+			if normalizeEOL {
+				kvPair.Value = bytes.Replace(bytes.Replace(kvPair.Value, []byte("\r\n"), []byte("\n"), -1), []byte("\r"), []byte("\n"), -1)
+			}
+
+			parts := strings.Split(kvPair.Key, sep)
+			folder := strings.Join(parts[:len(parts)-1], sep)
+			folder = list.path.qualifier() + strings.Trim(folder, "/"+sep)
+			varName := parts[len(parts)-1]
+
+			if withDescriptions && strings.HasSuffix(varName, descriptionSuffix) {
+				if _, ok := descriptions[folder]; !ok {
+					descriptions[folder] = make(map[string]string)
+				}
+				descriptions[folder][strings.TrimSuffix(varName, descriptionSuffix)] = string(kvPair.Value)
+				continue
+			}
+
+			if varName != "" {
+				if !varNamePattern.MatchString(varName) {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "Invalid var: %s\n", kvPair.Key)
+					}
+					invalid = append(invalid, varName)
+				} else {
+					if resolve {
+						v, err := resolveServices(ctx, consul, list.path, string(kvPair.Value), services)
+						if err != nil {
+							return nil, err
 						}
+						kvPair.Value = []byte(v)
+					}
+					if _, ok := envMap[folder]; !ok {
+						envMap[folder] = make(map[string]*consulapi.KVPair)
+					}
+					envMap[folder][varName] = kvPair
+					if !contains(envKeys, varName) {
+						envKeys = append([]string{varName}, envKeys...)
 					}
 				}
+			} else {
+				markers = append(markers, kvPair.Key)
+				markerFolders[kvPair.Key] = folder
 			}
 		}
 	}
 
-	processEnv(envMap, envKeys)
+	for _, marker := range markers {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Skipped directory marker %s\n", marker)
+		}
+		if warnEmptyDirs && len(envMap[markerFolders[marker]]) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s is an empty directory, no variables found in it\n", marker)
+		}
+	}
+
+	if len(invalid) > 0 {
+		names := invalid
+		if len(names) > maxInvalidListed && !verbose {
+			names = append(names[:maxInvalidListed:maxInvalidListed], "...")
+		}
+		fmt.Fprintf(os.Stderr, "-- %d keys skipped due to invalid names: %s --\n", len(invalid), strings.Join(names, ", "))
+	}
+
+	if verbose {
+		for _, pattern := range excludePaths {
+			if n := excluded[strings.Trim(pattern, "/")]; n > 0 {
+				fmt.Fprintf(os.Stderr, "Excluded %d keys matching %s\n", n, pattern)
+			}
+		}
+	}
+
+	runTimings.filter(filtered + len(invalid))
+	return &fetched{envMap: envMap, envKeys: envKeys, descriptions: descriptions, maxIndex: maxIndex, skipped: len(invalid), filtered: filtered, encodings: encodings, failed: failed}, nil
+}
+
+func Get(ctx context.Context) {
+	if _, err := parseEmits(); err != nil {
+		fail(1, "", "%s", err)
+	}
+
+	consul := connect(ctx)
+
+	retries := viper.GetInt("retry-on-empty")
+	delay := viper.GetDuration("retry-delay")
+
+	var f *fetched
+	for attempt := 0; ; attempt++ {
+		var err error
+		f, err = fetchEnv(ctx, consul)
+		if err != nil {
+			exitOnCancel(ctx)
+			fail(133, "", "%s", err)
+		}
+		if !f.empty() || attempt >= retries {
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "No keys found, retrying in %s (%d/%d)\n", delay, attempt+1, retries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			exitOnCancel(ctx)
+		}
+	}
+
+	if f.empty() && viper.GetBool("fail-on-empty") {
+		fail(137, "", "No keys found.")
+	}
+
+	snap := processEnv(f)
+	writeOutputs(snap, renderOutputs(snap))
+	audit(ctx, consul, snap)
+	runTimings.print()
+
+	// Index to pass as --modified-since-index on the next run
+	if viper.IsSet("modified-since-index") {
+		fmt.Fprintf(os.Stderr, "-- max modify index %d --\n", f.maxIndex)
+	}
+	// Skipped paths may have held keys, so their index is not final
+	failPartial(f.failed)
+	saveState(clientAddr(consul), f.maxIndex)
+}
+
+func GetValue(ctx context.Context, key string) {
+	noNewline := viper.GetBool("no-newline")
+	outputFile := viper.GetString("output-file")
+
+	consul := connect(ctx)
+
+	kvPair, qm, err := consul.KV().Get(strings.Trim(key, "/"), queryOptions(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, "", "%s %v", err, qm)
+	}
+	if kvPair == nil {
+		fail(136, key, "Key not found: %s", key)
+	}
+
+	data := kvPair.Value
+	if !noNewline {
+		data = append(data, '\n')
+	}
+
+	if err := writeOutput(outputFile, data, 0); err != nil {
+		fail(134, "", "Error writing output: %s", err)
+	}
 }
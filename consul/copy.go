@@ -0,0 +1,145 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Copy writes the key or subtree at src under dst, on the cluster at toAddr
+// when set. Destination keys holding another value are conflicts, left
+// alone unless overwrite. New keys are only created if still absent. With
+// dryRun only the plan is printed.
+func Copy(ctx context.Context, src string, dst string, toAddr string, dryRun bool, overwrite bool) {
+	from, to := parsePath(src), parsePath(dst)
+	if from.path == "" || to.path == "" {
+		fail(1, "", "Source and destination must not be empty.")
+	}
+	if toAddr == "" {
+		toAddr = viper.GetString("addr")
+	}
+	if toAddr == viper.GetString("addr") && scope(src) == scope(dst) && (inPath(to.path, from.path) || inPath(from.path, to.path)) {
+		fail(1, "", "Source and destination must not contain each other.")
+	}
+
+	source := connect(ctx)
+	dest := connectAddr(ctx, toAddr)
+
+	kvPairs, _, err := source.KV().List(from.path, from.options(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, src, "%s", err)
+	}
+	kvPairs = subtree(kvPairs, from.path)
+	if len(kvPairs) == 0 {
+		fail(136, src, "Key not found: %s", src)
+	}
+
+	existing, _, err := dest.KV().List(to.path, to.options(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, dst, "%s", err)
+	}
+	current := map[string]*consulapi.KVPair{}
+	for _, kvPair := range subtree(existing, to.path) {
+		current[kvPair.Key] = kvPair
+	}
+
+	var writes consulapi.KVPairs
+	var unchanged, conflicts int
+	for _, kvPair := range kvPairs {
+		key := to.path + strings.TrimPrefix(kvPair.Key, from.path)
+		old, ok := current[key]
+		switch {
+		case ok && bytes.Equal(old.Value, kvPair.Value) && old.Flags == kvPair.Flags:
+			unchanged++
+			continue
+		case ok && !overwrite:
+			conflicts++
+			fmt.Fprintf(os.Stderr, "! %s exists with another value, skipped\n", key)
+			continue
+		case ok:
+			fmt.Fprintf(os.Stderr, "~ %s -> %s\n", kvPair.Key, key)
+		default:
+			fmt.Fprintf(os.Stderr, "+ %s -> %s\n", kvPair.Key, key)
+		}
+		pair := *kvPair
+		pair.Key = key
+		// Only overwritten keys carry an index, new ones are created with CAS 0
+		pair.ModifyIndex = 0
+		if ok {
+			pair.ModifyIndex = old.ModifyIndex
+		}
+		writes = append(writes, &pair)
+	}
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "-- %d keys would be copied, %d unchanged, %d conflicts --\n", len(writes), unchanged, conflicts)
+		return
+	}
+
+	if err := copyPairs(ctx, dest, writes, to); err != nil {
+		exitOnCancel(ctx)
+		fail(133, dst, "%s", err)
+	}
+	fmt.Fprintf(os.Stderr, "-- %d keys copied, %d unchanged, %d conflicts --\n", len(writes), unchanged, conflicts)
+	if conflicts > 0 {
+		fail(135, dst, "%d keys not copied, use --overwrite to replace them", conflicts)
+	}
+}
+
+// Write the pairs with check-and-set on their index, so a key created or
+// changed at the destination meanwhile is not clobbered. One transaction
+// when they fit, otherwise key by key.
+func copyPairs(ctx context.Context, consul *consulapi.Client, pairs consulapi.KVPairs, to queryPath) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	opts := to.writeOptions(ctx)
+
+	if len(pairs) > maxTxnOps {
+		fmt.Fprintf(os.Stderr, "%d keys do not fit in one transaction, copying key by key\n", len(pairs))
+		kv := consul.KV()
+		for _, pair := range pairs {
+			ok, _, err := kv.CAS(pair, opts)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("%s changed during the copy", pair.Key)
+			}
+		}
+		return nil
+	}
+
+	var ops consulapi.TxnOps
+	for _, pair := range pairs {
+		ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{
+			Verb:      consulapi.KVCAS,
+			Key:       pair.Key,
+			Value:     pair.Value,
+			Flags:     pair.Flags,
+			Index:     pair.ModifyIndex,
+			Namespace: opts.Namespace,
+		}})
+	}
+
+	ok, resp, _, err := consul.Txn().Txn(ops, to.options(ctx))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		var msgs []string
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.What)
+		}
+		return errors.New("transaction failed: " + strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+func TestCopy(t *testing.T) {
+	tests := []struct {
+		name      string
+		src, dst  string
+		existing  []string // key=value pairs already at the destination
+		dryRun    bool
+		overwrite bool
+		want      map[string]string // destination keys afterwards
+		writes    bool
+	}{
+		{
+			name: "subtree to an empty prefix",
+			src:  "app", dst: "copy",
+			want:   map[string]string{"copy/A": "1", "copy/db/B": "2"},
+			writes: true,
+		},
+		{
+			name: "single key",
+			src:  "app/A", dst: "copy/X",
+			want:   map[string]string{"copy/X": "1"},
+			writes: true,
+		},
+		{
+			name: "unchanged keys are not written",
+			src:  "app", dst: "copy",
+			existing: []string{"copy/A", "1", "copy/db/B", "2"},
+			want:     map[string]string{"copy/A": "1", "copy/db/B": "2"},
+		},
+		{
+			name: "overwrite replaces other values",
+			src:  "app", dst: "copy",
+			existing:  []string{"copy/A", "old"},
+			overwrite: true,
+			want:      map[string]string{"copy/A": "1", "copy/db/B": "2"},
+			writes:    true,
+		},
+		{
+			name: "dry run writes nothing",
+			src:  "app", dst: "copy",
+			dryRun: true,
+			want:   map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			source := newConsulStub(t, "app/A", "1", "app/db/B", "2", "apps/C", "3")
+			dest := newConsulStub(t, tt.existing...)
+			viper.Set("addr", source.addr())
+			writes := dest.count("txn") + dest.count("put")
+
+			captureStderr(t, func() {
+				Copy(context.Background(), tt.src, tt.dst, dest.addr(), tt.dryRun, tt.overwrite)
+			})
+
+			got := map[string]string{}
+			dest.mu.Lock()
+			for _, pair := range dest.tree("copy") {
+				got[pair.Key] = string(pair.Value)
+			}
+			dest.mu.Unlock()
+			if len(got) != len(tt.want) {
+				t.Errorf("destination %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+			if wrote := dest.count("txn")+dest.count("put") != writes; wrote != tt.writes {
+				t.Errorf("destination written %v, want %v", wrote, tt.writes)
+			}
+			if n := source.count("put") + source.count("txn"); n != 0 {
+				t.Errorf("%d writes to the source", n)
+			}
+		})
+	}
+}
+
+// Written keys are check-and-set on the index they were read at, so a key
+// changed at the destination meanwhile fails the copy
+func TestCopyPairsConflict(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs int
+	}{
+		{name: "one transaction", pairs: 1},
+		{name: "key by key", pairs: maxTxnOps + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			dest := newConsulStub(t, "copy/A", "old")
+			var pairs consulapi.KVPairs
+			// Stale index for the existing key, created meanwhile for the others
+			pairs = append(pairs, &consulapi.KVPair{Key: "copy/A", Value: []byte("1"), ModifyIndex: 99})
+			for i := 1; i < tt.pairs; i++ {
+				pairs = append(pairs, &consulapi.KVPair{Key: "copy/k" + strings.Repeat("x", i), Value: []byte("v")})
+			}
+
+			captureStderr(t, func() {
+				if err := copyPairs(context.Background(), dest.client(), pairs, parsePath("copy")); err == nil {
+					t.Error("copy over a changed key succeeded")
+				}
+			})
+			if v, _ := dest.value("copy/A"); v != "old" {
+				t.Errorf("copy/A = %q, the changed key was clobbered", v)
+			}
+		})
+	}
+}
+
+// Copies that fail exit, so they run in a child process
+func TestCopyFails(t *testing.T) {
+	if args := os.Getenv("CONSULENV_TEST_COPY"); args != "" {
+		parts := strings.Split(args, "|")
+		source := newConsulStub(t, "app/A", "1", "app/B", "2")
+		viper.Set("addr", source.addr())
+		dest := source.addr()
+		if parts[2] != "same" {
+			dest = newConsulStub(t, "copy/A", "other").addr()
+		}
+		Copy(context.Background(), parts[0], parts[1], dest, false, false)
+		os.Exit(0)
+	}
+
+	tests := []struct {
+		name     string
+		src, dst string
+		sameAddr bool
+		code     int
+		want     string
+	}{
+		{name: "destination inside the source", src: "app", dst: "app/copy", sameAddr: true, code: 1, want: "must not contain each other"},
+		{name: "source inside the destination", src: "app/A", dst: "app", sameAddr: true, code: 1, want: "must not contain each other"},
+		{name: "conflict without --overwrite", src: "app", dst: "copy", code: 135, want: "1 keys not copied"},
+		{name: "missing source", src: "nothing", dst: "copy", code: 136, want: "Key not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Otherwise the child copies to a stub of its own
+			addr := "other"
+			if tt.sameAddr {
+				addr = "same"
+			}
+			cmd := exec.Command(os.Args[0], "-test.run=^TestCopyFails$")
+			cmd.Env = append(os.Environ(), "CONSULENV_TEST_COPY="+tt.src+"|"+tt.dst+"|"+addr)
+			out, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != tt.code {
+				t.Fatalf("exit %v, want %d: %s", err, tt.code, out)
+			}
+			if !strings.Contains(string(out), tt.want) {
+				t.Errorf("output %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package consul
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Characters bash still interprets inside double quotes
+var direnvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+
+// Render an .envrc snippet of export KEY="value" lines, preceded by a
+// watch_file directive for each --direnv-watch file so direnv reloads when
+// one of them changes.
+func renderDirenv(w io.Writer, s *snapshot) error {
+	var b strings.Builder
+	for _, file := range viper.GetStringSlice("direnv-watch") {
+		fmt.Fprintf(&b, "watch_file %s\n", shellQuote(file))
+	}
+	for _, k := range s.keys {
+		if desc := s.description(k); desc != "" {
+			writeComment(&b, desc)
+		}
+		fmt.Fprintf(&b, "export %s=\"%s\"\n", k, direnvEscaper.Replace(s.env[k]))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
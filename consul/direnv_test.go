@@ -0,0 +1,32 @@
+package consul
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRenderDirenv(t *testing.T) {
+	resetConfig(t)
+	viper.Set("direnv-watch", []string{"secrets", ".env.local", "it's here"})
+	s := &snapshot{
+		keys:         []string{"A", "B"},
+		env:          map[string]string{"A": "plain", "B": "\"$HOME\" `id` \\n"},
+		sources:      map[string]string{"A": "app", "B": "app"},
+		descriptions: map[string]map[string]string{"app": {"A": "the A"}},
+	}
+	var b strings.Builder
+	if err := renderDirenv(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	want := "watch_file secrets\n" +
+		"watch_file '.env.local'\n" +
+		"watch_file 'it'\\''s here'\n" +
+		"# the A\n" +
+		"export A=\"plain\"\n" +
+		"export B=\"\\\"\\$HOME\\\" \\`id\\` \\\\n\"\n"
+	if b.String() != want {
+		t.Errorf("renderDirenv =\n%s\nwant\n%s", b.String(), want)
+	}
+}
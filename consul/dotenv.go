@@ -0,0 +1,63 @@
+package consul
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Parse a dotenv file into its keys in file order and their values.
+// Lines may start with "export ", values may be wrapped in matching quotes
+// and followed by a # comment.
+func parseDotenv(file string) ([]string, map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var keys []string
+	env := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("%s:%d: expected KEY=value", file, n)
+		}
+		k := strings.TrimSpace(parts[0])
+		if _, ok := env[k]; !ok {
+			keys = append(keys, k)
+		}
+		env[k] = dotenvValue(parts[1])
+	}
+	return keys, env, scanner.Err()
+}
+
+// Value of a KEY=value line. A # only starts a comment outside quotes and
+// after whitespace, so KEY=pa#ss and KEY="pa # ss" keep their #.
+func dotenvValue(v string) string {
+	trimmed := strings.TrimSpace(v)
+	if len(trimmed) >= 2 && (trimmed[0] == '"' || trimmed[0] == '\'') {
+		if end := strings.IndexByte(trimmed[1:], trimmed[0]) + 1; end > 0 {
+			rest := strings.TrimSpace(trimmed[end+1:])
+			if rest == "" || strings.HasPrefix(rest, "#") {
+				return trimmed[1:end]
+			}
+		}
+	}
+
+	for i := 0; i < len(v); i++ {
+		if v[i] == '#' && i > 0 && (v[i-1] == ' ' || v[i-1] == '\t') {
+			return strings.TrimSpace(v[:i])
+		}
+	}
+	return trimmed
+}
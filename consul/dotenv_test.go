@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDotenvValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "pa#ss", want: "pa#ss"},
+		{value: "#leading", want: "#leading"},
+		{value: "value # note", want: "value"},
+		{value: "value\t# note", want: "value"},
+		{value: " value  #note # more", want: "value"},
+		{value: " # only a comment", want: ""},
+		{value: `"pa # ss"`, want: "pa # ss"},
+		{value: `"pa#ss" # note`, want: "pa#ss"},
+		{value: `'# hash'`, want: "# hash"},
+		{value: `'a#b'#c`, want: "a#b"},
+		{value: `"a" b # note`, want: `"a" b`},
+		{value: `"unterminated # note`, want: `"unterminated`},
+		{value: "a=b", want: "a=b"},
+	}
+	for _, tt := range tests {
+		if got := dotenvValue(tt.value); got != tt.want {
+			t.Errorf("dotenvValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.env")
+	data := "# header\n\nexport A=1 # one\nPASS=\"p#ss w0rd\"\nB = two\nA=again\nURL=http://h/#frag\n"
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, env, err := parseDotenv(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A", "PASS", "B", "URL"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %q, want %q", keys, want)
+	}
+	want := map[string]string{"A": "again", "PASS": "p#ss w0rd", "B": "two", "URL": "http://h/#frag"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("env %q, want %q", env, want)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("A=1\nnot a pair\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseDotenv(file); err == nil || err.Error() != file+":2: expected KEY=value" {
+		t.Errorf("parseDotenv error %v, want line 2 reported", err)
+	}
+}
@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Dump prints every key under the queried paths with its value as
+// fullkey<TAB>value lines, or a JSON object keyed by full key with asJSON.
+// Keys are not checked against variable naming rules and values are not
+// quoted. Tabs and newlines in values are escaped in the tabular form.
+func Dump(ctx context.Context, mask bool, asJSON bool) {
+	consul := connect(ctx)
+	secretFlag := viper.GetUint64("secret-flag")
+
+	lists, failed, err := listPaths(ctx, consul, pathsToQuery(Paths()))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, "", "%s", err)
+	}
+
+	values := map[string]string{}
+	var keys []string
+	for _, list := range lists {
+		for _, kvPair := range list.kvPairs {
+			key := list.path.qualifier() + kvPair.Key
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+			}
+			v := string(kvPair.Value)
+			if mask {
+				if secretFlag != 0 && kvPair.Flags == secretFlag {
+					v = maskedValue
+				}
+				v = redact(v)
+			}
+			values[key] = v
+		}
+	}
+	sort.Strings(keys)
+
+	if asJSON {
+		j, err := marshalJSON(values)
+		if err != nil {
+			fail(134, "", "creating JSON: %s", err)
+		}
+		fmt.Println(string(j))
+		failPartial(failed)
+		return
+	}
+
+	escape := strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+	for _, key := range keys {
+		fmt.Printf("%s\t%s\n", key, escape.Replace(values[key]))
+	}
+	failPartial(failed)
+}
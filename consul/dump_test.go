@@ -0,0 +1,48 @@
+package consul
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Keys that are no valid variable names are dumped verbatim, with masking
+// on request
+func TestDump(t *testing.T) {
+	tests := []struct {
+		name   string
+		mask   bool
+		asJSON bool
+		want   string
+	}{
+		{
+			name: "table",
+			want: "app/\t\napp/bad-name\tx\napp/db/my.key\tline1\\nline2\\tend\napp/secret\tpw\n",
+		},
+		{
+			name: "masked",
+			mask: true,
+			want: "app/\t\napp/bad-name\tx\napp/db/my.key\tline1\\nline2\\tend\napp/secret\t***\n",
+		},
+		{
+			name:   "json",
+			asJSON: true,
+			want:   `{"app/":"","app/bad-name":"x","app/db/my.key":"line1\nline2\tend","app/secret":"pw"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "app/", "", "app/bad-name", "x", "app/db/my.key", "line1\nline2\tend", "app/secret", "pw")
+			stub.pairs["app/secret"].Flags = 1
+			viper.Set("addr", stub.addr())
+			viper.Set("path", []string{"app"})
+			viper.Set("secret-flag", 1)
+
+			if out := captureStdout(t, func() { Dump(context.Background(), tt.mask, tt.asJSON) }); out != tt.want {
+				t.Errorf("Dump =\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
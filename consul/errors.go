@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Exit code of a --best-effort run where some paths failed
+const partialCode = 139
+
+// Error is a fatal failure as reported with --error-format json
+type Error struct {
+	Code    int    `json:"code"`
+	Kind    string `json:"kind"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Kind of failure for an exit code
+func errorKind(code int) string {
+	switch code {
+	case 130:
+		return "interrupted"
+	case 132:
+		return "permission"
+	case 133:
+		return "query"
+	case 134:
+		return "output"
+	case 135:
+		return "validation"
+	case 136, 137:
+		return "not-found"
+	case hookFailedCode:
+		return "hook"
+	case partialCode:
+		return "partial"
+	}
+	return "config"
+}
+
+// Check if a query failed before reaching Consul
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// Check if a query was denied by Consul's ACLs
+func isPermissionError(err error) bool {
+	var statusErr consulapi.StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusForbidden
+}
+
+// Report a fatal error and exit with code. path is the Consul path or key
+// the failure relates to, if any. A query failing because the token was
+// denied access is reported as a permission failure.
+func fail(code int, path string, format string, args ...interface{}) {
+	for _, arg := range args {
+		if err, ok := arg.(error); ok && code == 133 && isPermissionError(err) {
+			code = 132
+		}
+	}
+	report(code, path, format, args...)
+	exit(code)
+}
+
+// Print a fatal error, human readable by default, one JSON object on stderr
+// with --error-format json
+func report(code int, path string, format string, args ...interface{}) {
+	e := &Error{Code: code, Kind: errorKind(code), Path: path, Message: fmt.Sprintf(format, args...)}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok && code == 133 && isConnectionError(err) {
+			e.Kind = "connection"
+		}
+	}
+
+	if viper.GetString("error-format") == "json" {
+		j, _ := json.Marshal(e)
+		fmt.Fprintln(os.Stderr, string(j))
+	} else {
+		fmt.Fprintln(os.Stderr, e.Message)
+	}
+}
+
+// Fail reports a fatal error that is not tied to a path and exits with code
+func Fail(code int, format string, args ...interface{}) {
+	fail(code, "", format, args...)
+}
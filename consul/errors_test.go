@@ -0,0 +1,146 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Run fn with stderr redirected, returning what it wrote there
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	fn()
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+// Run fn with stdout redirected, returning what it wrote there
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+func TestReportJSON(t *testing.T) {
+	connErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		code int
+		path string
+		args []interface{}
+		kind string
+	}{
+		{code: 1, kind: "config"},
+		{code: 130, kind: "interrupted"},
+		{code: 132, kind: "permission"},
+		{code: 133, path: "app", args: []interface{}{errors.New("Unexpected response code: 500")}, kind: "query"},
+		{code: 133, path: "app", args: []interface{}{connErr}, kind: "connection"},
+		{code: 134, kind: "output"},
+		{code: 135, path: "app/A", kind: "validation"},
+		{code: 136, path: "app/A", kind: "not-found"},
+		{code: 137, kind: "not-found"},
+		{code: hookFailedCode, kind: "hook"},
+		{code: partialCode, path: "app,other", kind: "partial"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("error-format", "json")
+			format := "failed"
+			if len(tt.args) > 0 {
+				format = "failed: %s"
+			}
+
+			out := captureStderr(t, func() { report(tt.code, tt.path, format, tt.args...) })
+			var e Error
+			if err := json.Unmarshal([]byte(out), &e); err != nil {
+				t.Fatalf("not one JSON object: %q: %s", out, err)
+			}
+			if e.Code != tt.code || e.Kind != tt.kind || e.Path != tt.path || e.Message == "" {
+				t.Errorf("got %+v, want code %d kind %s path %q", e, tt.code, tt.kind, tt.path)
+			}
+
+			var fields map[string]interface{}
+			json.Unmarshal([]byte(out), &fields)
+			if _, ok := fields["path"]; ok != (tt.path != "") {
+				t.Errorf("path field present %v for path %q", ok, tt.path)
+			}
+		})
+	}
+}
+
+func TestReportText(t *testing.T) {
+	resetConfig(t)
+	out := captureStderr(t, func() { report(135, "app/A", "Invalid value: %s", "A") })
+	if out != "Invalid value: A\n" {
+		t.Errorf("got %q, want the plain message", out)
+	}
+}
+
+// A token denied access by Consul fails a fetch as a permission error
+func TestFetchDenied(t *testing.T) {
+	if token := os.Getenv("CONSULENV_TEST_DENIED"); token != "" {
+		stub := newConsulStub(t, "app/A", "1")
+		stub.denied = "denied"
+		viper.Set("addr", stub.addr())
+		viper.Set("token", token)
+		viper.Set("path", []string{"app", "missing"})
+		viper.Set("fail-on-empty", true)
+		viper.Set("error-format", "json")
+		Get(context.Background())
+		os.Exit(0)
+	}
+
+	tests := []struct {
+		token string
+		code  int
+		kind  string
+	}{
+		{token: "denied", code: 132, kind: "permission"},
+		{token: "allowed", code: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestFetchDenied$")
+			cmd.Env = append(os.Environ(), "CONSULENV_TEST_DENIED="+tt.token)
+			out, err := cmd.CombinedOutput()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+			if code != tt.code {
+				t.Fatalf("exit %d, want %d: %s", code, tt.code, out)
+			}
+			if tt.kind != "" && !strings.Contains(string(out), `"kind":"`+tt.kind+`"`) {
+				t.Errorf("output %q, want kind %s", out, tt.kind)
+			}
+		})
+	}
+}
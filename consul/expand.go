@@ -0,0 +1,70 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Variable name for a JSON field of key
+func fieldName(key string, field string) string {
+	return key + "_" + strings.ToUpper(invalidNameChars.ReplaceAllString(field, "_"))
+}
+
+func jsonScalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return fmt.Sprint(t)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Expand a JSON object value into one variable per field. Nested objects are
+// flattened further when nested is set, otherwise kept as JSON strings.
+// ok is false when value is not a JSON object.
+func expandJSON(key string, value string, nested bool) (keys []string, env map[string]string, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil || obj == nil || dec.More() {
+		return nil, nil, false
+	}
+
+	env = make(map[string]string)
+	var walk func(prefix string, obj map[string]interface{})
+	walk = func(prefix string, obj map[string]interface{}) {
+		fields := make([]string, 0, len(obj))
+		for field := range obj {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			name := fieldName(prefix, field)
+			if child, isObj := obj[field].(map[string]interface{}); isObj && nested {
+				walk(name, child)
+				continue
+			}
+			if _, dup := env[name]; !dup {
+				keys = append(keys, name)
+			}
+			env[name] = jsonScalar(obj[field])
+		}
+	}
+	walk(key, obj)
+
+	return keys, env, true
+}
@@ -0,0 +1,81 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestExpandJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		nested bool
+		keys   []string
+		env    map[string]string
+	}{
+		{
+			name:  "flat object",
+			value: `{"host":"h","port":5432,"ssl":true,"opt":null,"max-conn":12345678901234567890}`,
+			keys:  []string{"DB_HOST", "DB_MAX_CONN", "DB_OPT", "DB_PORT", "DB_SSL"},
+			env:   map[string]string{"DB_HOST": "h", "DB_MAX_CONN": "12345678901234567890", "DB_OPT": "", "DB_PORT": "5432", "DB_SSL": "true"},
+		},
+		{
+			name:  "nested kept as JSON",
+			value: `{"primary":{"host":"a","port":1},"list":[1,2]}`,
+			keys:  []string{"DB_LIST", "DB_PRIMARY"},
+			env:   map[string]string{"DB_LIST": "[1,2]", "DB_PRIMARY": `{"host":"a","port":1}`},
+		},
+		{
+			name:   "nested flattened",
+			value:  `{"primary":{"host":"a","port":1},"list":[1,2]}`,
+			nested: true,
+			keys:   []string{"DB_LIST", "DB_PRIMARY_HOST", "DB_PRIMARY_PORT"},
+			env:    map[string]string{"DB_LIST": "[1,2]", "DB_PRIMARY_HOST": "a", "DB_PRIMARY_PORT": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, env, ok := expandJSON("DB", tt.value, tt.nested)
+			if !ok {
+				t.Fatalf("expandJSON(%s) not expanded", tt.value)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(env, tt.env) {
+				t.Errorf("expandJSON(%s) = %q %q, want %q %q", tt.value, keys, env, tt.keys, tt.env)
+			}
+		})
+	}
+
+	for _, value := range []string{"plain", "", "42", `"str"`, "[1,2]", "null", `{"a":1} {"b":2}`, `{"a":`} {
+		if _, _, ok := expandJSON("DB", value, true); ok {
+			t.Errorf("expandJSON(%s) expanded, want it passed through", value)
+		}
+	}
+}
+
+// Expanded fields replace the object, explicitly defined variables win over
+// them and other values pass through
+func TestExpandJSONEnv(t *testing.T) {
+	resetConfig(t)
+	viper.Set("path", []string{"app"})
+	viper.Set("expand-json", true)
+	f := newFetched(map[string]map[string]string{"app": {
+		"DB":      `{"host":"h","port":5432}`,
+		"DB_PORT": "6432",
+		"LIST":    "[1,2]",
+		"NAME":    "plain",
+	}})
+
+	snap := processEnv(f)
+	want := map[string]string{"DB_HOST": "h", "DB_PORT": "6432", "LIST": "[1,2]", "NAME": "plain"}
+	if !reflect.DeepEqual(snap.env, want) {
+		t.Errorf("env %q, want %q", snap.env, want)
+	}
+	if len(snap.keys) != len(want) {
+		t.Errorf("keys %q, want %d", snap.keys, len(want))
+	}
+	if snap.sources["DB_HOST"] != "app" || snap.winners["DB_HOST"] != f.envMap["app"]["DB"] {
+		t.Errorf("DB_HOST from %q, want the app/DB key", snap.sources["DB_HOST"])
+	}
+}
@@ -0,0 +1,114 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Keys read at the same time with --get-key
+const getConcurrency = 8
+
+// Full keys named by --get-key and --get-keys-file, in order and under
+// --prefix
+func namedKeys() []string {
+	keys := append([]string{}, viper.GetStringSlice("get-key")...)
+	if file := viper.GetString("get-keys-file"); file != "" {
+		names, err := readNames(file)
+		if err != nil {
+			fail(1, "", "Unable to read keys file: %s", err)
+		}
+		keys = append(keys, names...)
+	}
+	if prefix := viper.GetString("prefix"); prefix != "" {
+		prefixed := make([]string, len(keys))
+		for i, k := range keys {
+			prefixed[i] = prefixPath(prefix, k)
+		}
+		keys = prefixed
+	}
+	return keys
+}
+
+// Folders of the named keys in the order the keys are given, so the first
+// key wins when two share a variable name
+func namedKeyFolders(keys []string) []string {
+	sep := keySeparator()
+	var folders []string
+	for _, k := range keys {
+		qp := parsePath(k)
+		folder := ""
+		if i := strings.LastIndex(qp.path, sep); i >= 0 {
+			folder = qp.path[:i]
+		}
+		folder = queryPath{path: folder, datacenter: qp.datacenter, namespace: qp.namespace}.String()
+		if !contains(folders, folder) {
+			folders = append(folders, folder)
+		}
+	}
+	return folders
+}
+
+// Get each named key instead of listing folders. Missing keys are warned
+// about, or fatal with --strict.
+func listNamed(ctx context.Context, consul *consulapi.Client, keys []string) ([]pathList, error) {
+	kv := consul.KV()
+	verbose := viper.GetBool("verbose")
+
+	lists := make([]pathList, len(keys))
+	errs := make([]error, len(keys))
+	sem := make(chan struct{}, getConcurrency)
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i int, qp queryPath) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if verbose {
+				fmt.Fprintln(os.Stderr, "Getting", qp)
+			}
+			start := time.Now()
+			var kvPair *consulapi.KVPair
+			err := withFallback(ctx, qp, func(opts *consulapi.QueryOptions) error {
+				var err error
+				kvPair, _, err = kv.Get(qp.path, opts)
+				return err
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			lists[i].path = qp
+			if kvPair != nil {
+				lists[i].kvPairs = []*consulapi.KVPair{kvPair}
+			}
+			runTimings.record("get", qp.String(), start, len(lists[i].kvPairs))
+		}(i, parsePath(k))
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, list := range lists {
+		if len(list.kvPairs) > 0 {
+			continue
+		}
+		if viper.GetBool("strict") {
+			fail(136, list.path.String(), "Key not found: %s", list.path)
+		}
+		fmt.Fprintf(os.Stderr, "Key not found: %s\n", list.path)
+	}
+	return lists, nil
+}
@@ -0,0 +1,94 @@
+package consul
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Fetch and merge with the configuration set up by config
+func fetchSnapshot(t *testing.T, stub *consulStub, config func()) *snapshot {
+	t.Helper()
+	resetConfig(t)
+	config()
+	f, err := fetchEnv(context.Background(), stub.client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return processEnv(f)
+}
+
+func TestGetKeysMatchesList(t *testing.T) {
+	stub := newConsulStub(t, "app/A", "1", "app/B", "2", "app/db/C", "3", "other/A", "4", "other/D", "5")
+
+	tests := []struct {
+		name  string
+		keys  []string
+		paths []string
+		want  map[string]string // listing the paths
+		named int               // variables from the keys
+	}{
+		{
+			name:  "every key of a path",
+			keys:  []string{"app/A", "app/B", "app/db/C"},
+			paths: []string{"app", "app/db"},
+			want:  map[string]string{"A": "1", "B": "2", "C": "3"},
+			named: 3,
+		},
+		{
+			name:  "first key wins like the first path",
+			keys:  []string{"app/A", "other/A", "other/D"},
+			paths: []string{"app", "other"},
+			want:  map[string]string{"A": "1", "B": "2", "D": "5"},
+			named: 2,
+		},
+		{
+			name:  "later key wins when listed first",
+			keys:  []string{"other/A", "app/A"},
+			paths: []string{"other", "app"},
+			want:  map[string]string{"A": "4", "B": "2", "D": "5"},
+			named: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			named := fetchSnapshot(t, stub, func() { viper.Set("get-key", tt.keys) })
+			listed := fetchSnapshot(t, stub, func() { viper.Set("path", tt.paths) })
+
+			for _, k := range named.keys {
+				if named.env[k] != listed.env[k] {
+					t.Errorf("%s = %q with --get-key, %q when listed", k, named.env[k], listed.env[k])
+				}
+			}
+			if !reflect.DeepEqual(listed.env, tt.want) {
+				t.Errorf("listed %v, want %v", listed.env, tt.want)
+			}
+			if len(named.keys) != tt.named {
+				t.Errorf("--get-key gave %v for %v, want %d variables", named.keys, tt.keys, tt.named)
+			}
+		})
+	}
+}
+
+func TestGetKeysMissing(t *testing.T) {
+	stub := newConsulStub(t, "app/A", "1")
+	var snap *snapshot
+	out := captureStderr(t, func() {
+		snap = fetchSnapshot(t, stub, func() { viper.Set("get-key", []string{"app/A", "app/MISSING"}) })
+	})
+	if snap.env["A"] != "1" || len(snap.env) != 1 {
+		t.Errorf("env %v, want only A=1", snap.env)
+	}
+	if want := "Key not found: app/MISSING"; !strings.Contains(out, want) {
+		t.Errorf("stderr %q, want %q", out, want)
+	}
+	if got := stub.count("get"); got != 2 {
+		t.Errorf("%d gets, want one per key", got)
+	}
+	if got := stub.count("list"); got != 0 {
+		t.Errorf("%d lists, named keys are never listed", got)
+	}
+}
@@ -0,0 +1,80 @@
+package consul
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Run a shell command with extra KEY=value environment. Its output goes to
+// stderr so it never mixes with rendered output on stdout.
+func runHook(command string, env ...string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Exit code when a --pre-hook or --post-hook fails with --hook-fatal
+const hookFailedCode = 138
+
+var (
+	hooksActive  bool
+	postHookOnce sync.Once
+)
+
+// PreHook runs --pre-hook before a fetch and arms --post-hook, which then
+// runs on every exit from here on. Only the root command fetches with hooks,
+// subcommands like dump, where and copy never call PreHook.
+func PreHook() {
+	hooksActive = true
+	if command := viper.GetString("pre-hook"); command != "" {
+		if err := runHook(command, "CONSULENV_PATHS="+strings.Join(Paths(), ",")); err != nil {
+			hookFailed("pre-hook", err)
+		}
+	}
+}
+
+// PostHook runs --post-hook once with the exit status of the fetch in
+// CONSULENV_STATUS. A fatal failure exits directly, as exit() would run
+// PostHook again from inside the Once.
+func PostHook(status int) {
+	if !hooksActive {
+		return
+	}
+	var hookErr error
+	postHookOnce.Do(func() {
+		command := viper.GetString("post-hook")
+		if command == "" {
+			return
+		}
+		hookErr = runHook(command, "CONSULENV_PATHS="+strings.Join(Paths(), ","), "CONSULENV_STATUS="+strconv.Itoa(status))
+	})
+	if hookErr == nil {
+		return
+	}
+	if status == 0 && viper.GetBool("hook-fatal") {
+		report(hookFailedCode, "", "post-hook command failed: %s", hookErr)
+		os.Exit(hookFailedCode)
+	}
+	fmt.Fprintf(os.Stderr, "post-hook command failed: %s\n", hookErr)
+}
+
+func hookFailed(name string, err error) {
+	if viper.GetBool("hook-fatal") {
+		fail(hookFailedCode, "", "%s command failed: %s", name, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s command failed: %s\n", name, err)
+}
+
+// Exit with code after running --post-hook
+func exit(code int) {
+	PostHook(code)
+	os.Exit(code)
+}
@@ -0,0 +1,83 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Hooks run around the fetch, the pre-hook before any output is written and
+// the post-hook after it with the exit status. Each run happens in a child
+// process, as failures exit.
+func TestHooks(t *testing.T) {
+	if dir := os.Getenv("CONSULENV_TEST_HOOKS"); dir != "" {
+		stub := newConsulStub(t, "app/A", "1")
+		stub.denied = "denied"
+		viper.Set("addr", stub.addr())
+		viper.Set("path", []string{"app"})
+		viper.Set("output-file", filepath.Join(dir, "out"))
+		viper.Set("pre-hook", os.Getenv("CONSULENV_TEST_PRE"))
+		viper.Set("post-hook", os.Getenv("CONSULENV_TEST_POST"))
+		viper.Set("hook-fatal", os.Getenv("CONSULENV_TEST_FATAL") != "")
+		viper.Set("token", os.Getenv("CONSULENV_TEST_TOKEN"))
+		PreHook()
+		Get(context.Background())
+		PostHook(0)
+		os.Exit(0)
+	}
+
+	const (
+		pre  = `echo "pre $CONSULENV_PATHS" >> log; test ! -f out`
+		post = `test -f out && echo "post $CONSULENV_STATUS" >> log`
+	)
+	tests := []struct {
+		name   string
+		pre    string
+		post   string
+		fatal  bool
+		token  string
+		code   int
+		log    string
+		output bool
+	}{
+		{name: "in order", pre: pre, post: post, log: "pre app\npost 0\n", output: true},
+		{name: "pre-hook failure", pre: "false", post: `echo "post $CONSULENV_STATUS" >> log`, log: "post 0\n", output: true},
+		{name: "fatal pre-hook failure", pre: "false", post: `echo "post $CONSULENV_STATUS" >> log`, fatal: true, code: hookFailedCode, log: "post 138\n"},
+		{name: "post-hook failure", pre: pre, post: "false", log: "pre app\n", output: true},
+		{name: "fatal post-hook failure", pre: pre, post: post + "; false", fatal: true, code: hookFailedCode, log: "pre app\npost 0\n", output: true},
+		{name: "failed fetch", pre: pre, post: `echo "post $CONSULENV_STATUS" >> log; false`, fatal: true, token: "denied", code: 132, log: "pre app\npost 132\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestHooks$")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "CONSULENV_TEST_HOOKS="+dir, "CONSULENV_TEST_PRE="+tt.pre,
+				"CONSULENV_TEST_POST="+tt.post, "CONSULENV_TEST_TOKEN="+tt.token)
+			if tt.fatal {
+				cmd.Env = append(cmd.Env, "CONSULENV_TEST_FATAL=1")
+			}
+			out, err := cmd.CombinedOutput()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+			if code != tt.code {
+				t.Fatalf("exit %d, want %d: %s", code, tt.code, out)
+			}
+			if log, _ := ioutil.ReadFile(filepath.Join(dir, "log")); string(log) != tt.log {
+				t.Errorf("hooks logged %q, want %q", log, tt.log)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "out")); (err == nil) != tt.output {
+				t.Errorf("output written %v, want %v", err == nil, tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Write options for the path, with the same datacenter, namespace and token
+// resolution as its queries
+func (qp queryPath) writeOptions(ctx context.Context) *consulapi.WriteOptions {
+	q := qp.options(ctx)
+	w := &consulapi.WriteOptions{
+		Datacenter: q.Datacenter,
+		Namespace:  q.Namespace,
+		Token:      q.Token,
+	}
+	return w.WithContext(ctx)
+}
+
+// Largest value Consul accepts by default
+const maxConsulValueSize = 512 * 1024
+
+// Resolve curl-style @file values to the file's content, @@ escapes a
+// literal leading @. Files are checked against the smaller of
+// --max-value-size and the Consul limit.
+func fileValue(v string) (string, error) {
+	if strings.HasPrefix(v, "@@") {
+		return v[1:], nil
+	}
+	if !strings.HasPrefix(v, "@") {
+		return v, nil
+	}
+
+	file := v[1:]
+	limit := int64(viper.GetInt("max-value-size"))
+	if limit <= 0 || limit > maxConsulValueSize {
+		limit = maxConsulValueSize
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() > limit {
+		return "", fmt.Errorf("%s is %d bytes, max %d", file, fi.Size(), limit)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Import puts every variable of a dotenv file under path, skipping those
+// that already hold the same value. With dryRun nothing is written, the
+// changes are printed as + (new), ~ (changed) and = (unchanged) lines with
+// masked values. Values of the form @file are read from that file.
+func Import(ctx context.Context, path string, file string, dryRun bool) {
+	keys, env, err := parseDotenv(file)
+	if err != nil {
+		fail(1, "", "Error reading %s: %s", file, err)
+	}
+	for _, k := range keys {
+		v, err := fileValue(env[k])
+		if err != nil {
+			fail(1, k, "Invalid value for %s: %s", k, err)
+		}
+		env[k] = v
+	}
+
+	consul := connect(ctx)
+	qp := parsePath(path)
+	kv := consul.KV()
+
+	prefix := ""
+	if qp.path != "" {
+		prefix = qp.path + keySeparator()
+	}
+
+	existing, _, err := kv.List(prefix, qp.options(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, "", "%s", err)
+	}
+	current := make(map[string]string, len(existing))
+	for _, kvPair := range existing {
+		current[kvPair.Key] = string(kvPair.Value)
+	}
+
+	var added, changed, unchanged int
+	for _, k := range keys {
+		key := prefix + k
+		old, ok := current[key]
+		switch {
+		case !ok:
+			added++
+			if dryRun {
+				fmt.Printf("+ %s=%s\n", key, maskedValue)
+			}
+		case old != env[k]:
+			changed++
+			if dryRun {
+				fmt.Printf("~ %s=%s\n", key, maskedValue)
+			}
+		default:
+			unchanged++
+			if dryRun {
+				fmt.Printf("= %s\n", key)
+			}
+			continue
+		}
+		if dryRun {
+			continue
+		}
+
+		if _, err := kv.Put(&consulapi.KVPair{Key: key, Value: []byte(env[k])}, qp.writeOptions(ctx)); err != nil {
+			exitOnCancel(ctx)
+			fail(133, key, "Error writing %s: %s", key, err)
+		}
+	}
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "-- %d new, %d changed, %d unchanged, nothing written --\n", added, changed, unchanged)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "-- %d keys imported, %d unchanged --\n", added+changed, unchanged)
+}
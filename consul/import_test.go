@@ -0,0 +1,124 @@
+package consul
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// The dry run prints new, changed and unchanged keys with masked values and
+// writes nothing, the real import only writes the new and changed ones
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+		want   string
+		puts   int
+		report string
+	}{
+		{
+			name:   "dry run",
+			dryRun: true,
+			want:   "+ app/ADDED=***\n~ app/CHANGED=***\n= app/SAME\n",
+			report: "-- 1 new, 1 changed, 1 unchanged, nothing written --",
+		},
+		{name: "import", puts: 2, report: "-- 2 keys imported, 1 unchanged --"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "app/SAME", "1", "app/CHANGED", "old", "app/KEPT", "k")
+			viper.Set("addr", stub.addr())
+			file := filepath.Join(t.TempDir(), "app.env")
+			if err := ioutil.WriteFile(file, []byte("ADDED=new-secret\nCHANGED=new\nSAME=1\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var out string
+			stderr := captureStderr(t, func() {
+				out = captureStdout(t, func() { Import(context.Background(), "app", file, tt.dryRun) })
+			})
+			if out != tt.want {
+				t.Errorf("output\n%s\nwant\n%s", out, tt.want)
+			}
+			if !strings.Contains(stderr, tt.report) {
+				t.Errorf("stderr %q, want %q", stderr, tt.report)
+			}
+			if got := stub.count("put"); got != tt.puts {
+				t.Errorf("%d puts, want %d", got, tt.puts)
+			}
+
+			want := map[string]string{"app/SAME": "1", "app/CHANGED": "old", "app/KEPT": "k"}
+			if !tt.dryRun {
+				want["app/ADDED"], want["app/CHANGED"] = "new-secret", "new"
+			}
+			if _, ok := stub.value("app/ADDED"); ok != !tt.dryRun {
+				t.Errorf("app/ADDED written %v, want %v", ok, !tt.dryRun)
+			}
+			for k, v := range want {
+				if got, _ := stub.value(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestFileValue(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(cert, []byte("-----BEGIN CERTIFICATE-----\nabc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		limit   int
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", value: "value", want: "value"},
+		{name: "file", value: "@" + cert, want: "-----BEGIN CERTIFICATE-----\nabc\n"},
+		{name: "escaped", value: "@@literal", want: "@literal"},
+		{name: "escaped file name", value: "@@" + cert, want: "@" + cert},
+		{name: "missing file", value: "@" + filepath.Join(dir, "missing"), wantErr: true},
+		{name: "too large", value: "@" + cert, limit: 10, wantErr: true},
+		{name: "at the limit", value: "@" + cert, limit: 32, want: "-----BEGIN CERTIFICATE-----\nabc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("max-value-size", tt.limit)
+			got, err := fileValue(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("fileValue(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// @file values are stored with the file's content
+func TestImportFileValue(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t)
+	viper.Set("addr", stub.addr())
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_rsa")
+	file := filepath.Join(dir, "app.env")
+	ioutil.WriteFile(key, []byte("private\nkey\n"), 0600)
+	if err := ioutil.WriteFile(file, []byte("KEY=@"+key+"\nMAIL=@@team\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	captureStderr(t, func() { Import(context.Background(), "app", file, false) })
+	for k, want := range map[string]string{"app/KEY": "private\nkey\n", "app/MAIL": "@team"} {
+		if got, _ := stub.value(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const iniDefaultSection = "DEFAULT"
+
+func iniEscape(v string) string {
+	if v == "" {
+		return v
+	}
+	if !strings.ContainsAny(v, ";#=\"\\\n\r\t") && strings.TrimSpace(v) == v {
+		return v
+	}
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+	return fmt.Sprintf("\"%s\"", r.Replace(v))
+}
+
+// Render the merged variables grouped into sections named after the Consul
+// folder each was taken from, relative to the outermost queried path holding
+// it (or --relative-to). Variables of a queried path itself, and those not
+// from Consul, go to [DEFAULT]. Everything applied to the flat output
+// (selection, masking, renames, overlays) applies here as well.
+func renderINI(w io.Writer, s *snapshot) error {
+	var sections []string
+	values := map[string]map[string]string{}
+	descriptions := map[string]map[string]string{}
+	order := map[string][]string{}
+	rank := map[string]int{}
+
+	for _, k := range s.keys {
+		section, at := iniSection(s.paths, s.sources[k])
+		if _, ok := values[section]; !ok {
+			values[section] = make(map[string]string)
+			descriptions[section] = make(map[string]string)
+			sections = append(sections, section)
+			rank[section] = at
+		}
+		values[section][k] = s.env[k]
+		descriptions[section][k] = s.description(k)
+		order[section] = append(order[section], k)
+	}
+
+	// [DEFAULT] first, then sections by the path they belong to. Keys keep
+	// the output order of the snapshot.
+	sort.SliceStable(sections, func(i, j int) bool {
+		if (sections[i] == iniDefaultSection) != (sections[j] == iniDefaultSection) {
+			return sections[i] == iniDefaultSection
+		}
+		if rank[sections[i]] != rank[sections[j]] {
+			return rank[sections[i]] < rank[sections[j]]
+		}
+		return sections[i] < sections[j]
+	})
+	if err := caseCollisions("INI sections", sections); err != nil {
+		return err
+	}
+	for _, section := range sections {
+		if err := caseCollisions("INI keys in ["+section+"]", order[section]); err != nil {
+			return err
+		}
+	}
+
+	var b strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", section)
+		for _, k := range order[section] {
+			if desc := descriptions[section][k]; desc != "" {
+				writeComment(&b, desc)
+			}
+			fmt.Fprintf(&b, "%s = %s\n", k, iniEscape(values[section][k]))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Section of the folder a variable was taken from and the index of the
+// outermost queried path holding it
+func iniSection(paths []string, folder string) (string, int) {
+	at := -1
+	for i, path := range paths {
+		if inPath(folder, path) && (at < 0 || len(path) < len(paths[at])) {
+			at = i
+		}
+	}
+	if at < 0 {
+		return iniDefaultSection, len(paths)
+	}
+	if section := relativeFolder(folder, paths[at]); section != "" {
+		return section, at
+	}
+	return iniDefaultSection, at
+}
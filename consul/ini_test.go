@@ -0,0 +1,96 @@
+package consul
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Sections are built from the merged variables, so whatever the flat output
+// drops or masks is dropped or masked in INI as well
+func TestRenderINI(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(dir string)
+		want   string
+	}{
+		{
+			name:   "all variables",
+			config: func(string) {},
+			want:   "[DEFAULT]\nHOST = h\nTOKEN = s3cret\n\n[db]\nPASS = \"s=1\"\nUSER = u\n",
+		},
+		{
+			name: "selection",
+			config: func(dir string) {
+				file := filepath.Join(dir, "select")
+				ioutil.WriteFile(file, []byte("HOST\nUSER\n"), 0600)
+				viper.Set("select-file", file)
+			},
+			want: "[DEFAULT]\nHOST = h\n\n[db]\nUSER = u\n",
+		},
+		{
+			name: "value match masks secrets",
+			config: func(string) {
+				viper.Set("value-match", "s")
+			},
+			want: "[DEFAULT]\nTOKEN = ***\n\n[db]\nPASS = ***\n",
+		},
+		{
+			name: "renamed variables",
+			config: func(string) {
+				viper.Set("naming", "camel")
+				viper.Set("limit", 3)
+			},
+			want: "[DEFAULT]\nhost = h\ntoken = s3cret\n\n[db]\npass = \"s=1\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("path", []string{"app", "app/db"})
+			viper.Set("secret-flag", 1)
+			f := newFetched(map[string]map[string]string{
+				"app":    {"HOST": "h", "TOKEN": "s3cret"},
+				"app/db": {"USER": "u", "PASS": "s=1"},
+			})
+			f.envMap["app"]["TOKEN"].Flags = 1
+			f.envMap["app/db"]["PASS"].Flags = 1
+			tt.config(t.TempDir())
+
+			var b strings.Builder
+			if err := renderINI(&b, processEnv(f)); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("renderINI =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestINISection(t *testing.T) {
+	tests := []struct {
+		folder     string
+		relativeTo string
+		want       string
+	}{
+		{folder: "app", want: iniDefaultSection},
+		{folder: "app/db", want: "db"},
+		{folder: "app/db/replica", want: "db/replica"},
+		{folder: "other", want: iniDefaultSection},
+		{folder: ".env.local", want: iniDefaultSection},
+		{folder: "app/db/replica", relativeTo: "app/db", want: "replica"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.folder, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("relative-to", tt.relativeTo)
+			if got, _ := iniSection([]string{"app/db", "app"}, tt.folder); got != tt.want {
+				t.Errorf("iniSection(%q) = %q, want %q", tt.folder, got, tt.want)
+			}
+		})
+	}
+}
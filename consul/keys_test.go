@@ -0,0 +1,64 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Keys of all paths are sorted together by default, --group-by-path keeps
+// them per path in query order
+func TestKeysOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		group  bool
+		counts bool
+		want   string
+	}{
+		{name: "sorted", want: "alpha/C\nzeta/A\nzeta/B\nzeta/sub/\n"},
+		{name: "grouped by path", group: true, want: "zeta/A\nzeta/B\nzeta/sub/\nalpha/C\n"},
+		{name: "with counts", counts: true, want: "alpha/C\nzeta/A\nzeta/B\nzeta/sub/ (2 keys)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "zeta/B", "2", "zeta/A", "1", "zeta/sub/X", "x", "zeta/sub/Y", "y", "alpha/C", "3")
+			viper.Set("addr", stub.addr())
+			viper.Set("path", []string{"zeta", "alpha"})
+			viper.Set("group-by-path", tt.group)
+			viper.Set("counts", tt.counts)
+
+			if out := captureStdout(t, func() { Keys(context.Background()) }); out != tt.want {
+				t.Errorf("Keys =\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+// --counts counts every key below a folder, however deep, and counts more
+// folders than countConcurrency
+func TestKeysCountsNested(t *testing.T) {
+	resetConfig(t)
+	pairs := []string{"app/top", "t", "app/deep/a/b/c/X", "x", "app/deep/a/Y", "y", "app/deep/Z", "z"}
+	for i := 0; i < countConcurrency+2; i++ {
+		pairs = append(pairs, fmt.Sprintf("app/many%02d/sub/K", i), "k")
+	}
+	stub := newConsulStub(t, pairs...)
+	viper.Set("addr", stub.addr())
+	viper.Set("path", []string{"app"})
+	viper.Set("counts", true)
+
+	want := "app/deep/ (3 keys)\n"
+	for i := 0; i < countConcurrency+2; i++ {
+		want += fmt.Sprintf("app/many%02d/ (1 keys)\n", i)
+	}
+	want += "app/top\n"
+	if out := captureStdout(t, func() { Keys(context.Background()) }); out != want {
+		t.Errorf("Keys =\n%s\nwant\n%s", out, want)
+	}
+	if n := stub.count("keys"); n != countConcurrency+4 {
+		t.Errorf("%d keys calls, want one per folder plus the listing", n)
+	}
+}
@@ -0,0 +1,246 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// kv pairs listed under one queried path
+type pathList struct {
+	path    queryPath
+	kvPairs []*consulapi.KVPair
+}
+
+// List kv pairs under each path, from the --cache-dir snapshots with
+// --offline. Listings from Consul are saved to --cache-dir when set. Paths
+// skipped by --best-effort are returned with the listings of the others.
+func listPaths(ctx context.Context, consul *consulapi.Client, paths []string) ([]pathList, []string, error) {
+	var qps []queryPath
+	for _, p := range paths {
+		qps = append(qps, parsePath(p))
+	}
+
+	dir := viper.GetString("cache-dir")
+	addr := clientAddr(consul)
+	if viper.GetBool("offline") {
+		lists, err := listOffline(dir, addr, qps)
+		return lists, nil, err
+	}
+
+	var failed []string
+	lists, err := listConsul(ctx, consul, paths, qps, &failed)
+	if err == nil && dir != "" {
+		if err := saveSnapshots(dir, addr, lists); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache dir: %s\n", err)
+		}
+	}
+	return lists, failed, err
+}
+
+// With --consistent all paths are read in a single transaction, so they
+// reflect the same Raft index even if Consul is written to mid-run;
+// otherwise each path is a separate List call.
+func listConsul(ctx context.Context, consul *consulapi.Client, paths []string, qps []queryPath, failed *[]string) ([]pathList, error) {
+	verbose := viper.GetBool("verbose")
+
+	if keys := namedKeys(); len(keys) > 0 {
+		return listNamed(ctx, consul, keys)
+	}
+
+	if viper.GetBool("consistent") {
+		if verbose {
+			fmt.Fprintln(os.Stderr, "Looking at", strings.Join(paths, ", "), "in one transaction")
+		}
+		return listTxn(ctx, consul, qps)
+	}
+
+	if file := viper.GetString("cache-file"); file != "" {
+		return listCached(ctx, consul, qps, file, failed)
+	}
+
+	var lists []pathList
+	for _, qp := range qps {
+		if verbose {
+			fmt.Fprintln(os.Stderr, "Looking at", qp)
+		}
+		start := time.Now()
+		kvPairs, err := listWithFallback(ctx, consul.KV(), qp)
+		if err != nil {
+			if bestEffort(ctx, qp, err, failed) {
+				continue
+			}
+			return nil, err
+		}
+		runTimings.record("list", qp.String(), start, len(kvPairs))
+		lists = append(lists, pathList{path: qp, kvPairs: kvPairs})
+	}
+	return lists, nil
+}
+
+// List a path, retrying with --fallback-token when the primary token is
+// denied access
+func listWithFallback(ctx context.Context, kv *consulapi.KV, qp queryPath) (consulapi.KVPairs, error) {
+	var kvPairs consulapi.KVPairs
+	err := withFallback(ctx, qp, func(opts *consulapi.QueryOptions) error {
+		var err error
+		kvPairs, _, err = kv.List(qp.path, opts)
+		return err
+	})
+	return kvPairs, err
+}
+
+// Run a read of qp, again with --fallback-token when the primary token is
+// denied access. Neither token is ever printed, only which one was used.
+func withFallback(ctx context.Context, qp queryPath, read func(opts *consulapi.QueryOptions) error) error {
+	err := read(qp.options(ctx))
+	fallback := viper.GetString("fallback-token")
+	if err == nil || fallback == "" || !isPermissionError(err) {
+		return err
+	}
+
+	if viper.GetBool("verbose") {
+		fmt.Fprintln(os.Stderr, "Permission denied on", qp, "with the primary token, retrying with the fallback token")
+	}
+	opts := qp.options(ctx)
+	opts.Token = fallback
+	err = read(opts)
+	if err == nil && viper.GetBool("verbose") {
+		fmt.Fprintln(os.Stderr, "Read", qp, "with the fallback token")
+	}
+	return err
+}
+
+// With --best-effort, warn about a path that failed to list, add it to
+// failed and report whether to carry on without it. Interrupts are never
+// skipped.
+func bestEffort(ctx context.Context, qp queryPath, err error, failed *[]string) bool {
+	if !viper.GetBool("best-effort") || ctx.Err() != nil {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Error listing %s, skipping: %s\n", qp, err)
+	*failed = append(*failed, qp.String())
+	return true
+}
+
+// Exit with the partial code when --best-effort skipped paths
+func failPartial(failed []string) {
+	if len(failed) > 0 {
+		fail(partialCode, strings.Join(failed, ","), "-- %d of %d paths failed: %s --", len(failed), len(pathsToQuery(Paths())), strings.Join(failed, ", "))
+	}
+}
+
+// CheckListFlags rejects listing options that can not be combined. With
+// --best-effort paths must be listed one by one, a transaction or named
+// keys succeed or fail as a whole.
+func CheckListFlags() error {
+	if viper.GetString("cache-file") != "" && viper.GetBool("consistent") {
+		return errors.New("--cache-file can not be combined with --consistent")
+	}
+	// One cache file holds the listings of one server
+	if viper.GetString("cache-file") != "" && len(viper.GetStringSlice("cluster")) > 0 {
+		return errors.New("--cache-file can not be combined with --cluster")
+	}
+	// A transaction is read with one token, there is no retrying part of it
+	if viper.GetString("fallback-token") != "" && viper.GetBool("consistent") {
+		return errors.New("--fallback-token can not be combined with --consistent")
+	}
+	if !viper.GetBool("best-effort") {
+		return nil
+	}
+	if viper.GetBool("consistent") {
+		return errors.New("--best-effort can not be combined with --consistent")
+	}
+	if len(namedKeys()) > 0 {
+		return errors.New("--best-effort can not be combined with --get-key")
+	}
+	return nil
+}
+
+// List through the --cache-file. Only the paths of this run are kept, so a
+// changed path set drops the listings of paths no longer queried.
+func listCached(ctx context.Context, consul *consulapi.Client, qps []queryPath, file string, failed *[]string) ([]pathList, error) {
+	cache := loadCache(file, clientAddr(consul))
+	next := &kvCache{Addr: cache.Addr, Identity: cache.Identity, Lists: map[string]cachedList{}}
+
+	var lists []pathList
+	for _, qp := range qps {
+		if viper.GetBool("verbose") {
+			fmt.Fprintln(os.Stderr, "Looking at", qp)
+		}
+		kvPairs, err := cache.list(ctx, consul, qp)
+		if err != nil {
+			if bestEffort(ctx, qp, err, failed) {
+				continue
+			}
+			return nil, err
+		}
+		next.Lists[qp.String()] = cache.Lists[qp.String()]
+		lists = append(lists, pathList{path: qp, kvPairs: kvPairs})
+	}
+
+	if err := next.save(file); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing cache: %s\n", err)
+	}
+	return lists, nil
+}
+
+func listTxn(ctx context.Context, consul *consulapi.Client, qps []queryPath) ([]pathList, error) {
+	q := queryOptions(ctx)
+	q.RequireConsistent = true
+
+	var ops consulapi.TxnOps
+	for i, qp := range qps {
+		opts := qp.options(ctx)
+		if i > 0 && opts.Datacenter != q.Datacenter {
+			return nil, errors.New("--consistent can not span datacenters")
+		}
+		// One transaction is read with one token
+		if i > 0 && opts.Token != q.Token {
+			return nil, errors.New("--consistent can not span paths with different --path-token tokens")
+		}
+		q.Datacenter = opts.Datacenter
+		q.Token = opts.Token
+		ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{Verb: consulapi.KVGetTree, Key: qp.path, Namespace: opts.Namespace}})
+	}
+
+	start := time.Now()
+	ok, resp, _, err := consul.Txn().Txn(ops, q)
+	if err != nil {
+		return nil, err
+	}
+	runTimings.record("txn", "", start, len(resp.Results))
+	if !ok {
+		var msgs []string
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.What)
+		}
+		return nil, errors.New("transaction failed: " + strings.Join(msgs, "; "))
+	}
+
+	// Results are not grouped per operation, assign each pair back to the
+	// path it was listed under. Unique paths never overlap within a namespace.
+	lists := make([]pathList, len(qps))
+	for i, qp := range qps {
+		lists[i].path = qp
+	}
+	for _, result := range resp.Results {
+		if result.KV == nil {
+			continue
+		}
+		for i, qp := range qps {
+			ns := qp.options(ctx).Namespace
+			if strings.HasPrefix(result.KV.Key, qp.path) && (ns == "" || result.KV.Namespace == "" || ns == result.KV.Namespace) {
+				lists[i].kvPairs = append(lists[i].kvPairs, result.KV)
+				break
+			}
+		}
+	}
+	return lists, nil
+}
@@ -0,0 +1,57 @@
+package consul
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/viper"
+)
+
+// Where one emitted variable came from
+type manifestEntry struct {
+	Address     string `json:"address"`
+	Datacenter  string `json:"datacenter,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Source      string `json:"source"`
+	Key         string `json:"key,omitempty"`
+	ModifyIndex uint64 `json:"modify_index,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+// Write the --manifest file, keyed by variable name. Variables not read
+// from a Consul key (e.g. --overlay ones) only have their source.
+func writeManifest(file string, snap *snapshot) error {
+	addr := viper.GetString("addr")
+
+	manifest := make(map[string]manifestEntry, len(snap.keys))
+	for _, k := range snap.keys {
+		source := snap.sources[k]
+		entry := manifestEntry{Address: addr, Source: source}
+		if a, ok := snap.addrs[k]; ok {
+			entry.Address = a
+		}
+		if kvPair, ok := snap.winners[k]; ok {
+			qp := parsePath(source)
+			entry.Datacenter = qp.datacenter
+			if entry.Datacenter == "" {
+				entry.Datacenter = viper.GetString("datacenter")
+			}
+			entry.Namespace = kvPair.Namespace
+			if entry.Namespace == "" {
+				entry.Namespace = qp.namespace
+			}
+			if entry.Namespace == "" {
+				entry.Namespace = viper.GetString("namespace")
+			}
+			entry.Key = kvPair.Key
+			entry.ModifyIndex = kvPair.ModifyIndex
+			entry.Encoding = snap.encodings[kvPair.Key]
+		}
+		manifest[k] = entry
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, append(data, '\n'), 0600)
+}
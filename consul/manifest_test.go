@@ -0,0 +1,72 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Each variable records the key it won from, with the datacenter and
+// namespace of its path or the global ones; overlay variables only have
+// their source
+func TestWriteManifest(t *testing.T) {
+	resetConfig(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	overlay := filepath.Join(dir, "local.env")
+	if err := ioutil.WriteFile(overlay, []byte("LOCAL=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("addr", "consul.example:8500")
+	viper.Set("datacenter", "west")
+	viper.Set("namespace", "")
+	viper.Set("path", []string{"dc=east,ns=team:apps/payments", "apps/common"})
+	viper.Set("overlay", overlay)
+	f := newFetched(map[string]map[string]string{
+		"dc=east,ns=team:apps/payments": {"HOST": "pay"},
+		"apps/common":                   {"PORT": "80"},
+	})
+	f.encodings["apps/common/PORT"] = "base64"
+
+	snap := processEnv(f)
+	if err := writeManifest(manifest, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("manifest mode %v, want 0600", info.Mode().Perm())
+	}
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries map[string]manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]manifestEntry{
+		"HOST": {
+			Address: "consul.example:8500", Datacenter: "east", Namespace: "team",
+			Source: "dc=east,ns=team:apps/payments", Key: "apps/payments/HOST",
+			ModifyIndex: snap.winners["HOST"].ModifyIndex,
+		},
+		"PORT": {
+			Address: "consul.example:8500", Datacenter: "west",
+			Source: "apps/common", Key: "apps/common/PORT",
+			ModifyIndex: snap.winners["PORT"].ModifyIndex, Encoding: "base64",
+		},
+		"LOCAL": {Address: "consul.example:8500", Source: overlay},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("manifest =\n%s\nwant %+v", data, want)
+	}
+}
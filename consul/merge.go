@@ -0,0 +1,54 @@
+package consul
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Deep-merge JSON object low under high: high wins per leaf, objects present
+// in both are merged recursively. ok is false unless both are objects.
+func mergeJSON(high string, low string) (string, bool) {
+	h, ok := decodeObject(high)
+	if !ok {
+		return "", false
+	}
+	l, ok := decodeObject(low)
+	if !ok {
+		return "", false
+	}
+
+	merged, err := json.Marshal(mergeObjects(h, l))
+	if err != nil {
+		return "", false
+	}
+	return string(merged), true
+}
+
+func mergeObjects(high map[string]interface{}, low map[string]interface{}) map[string]interface{} {
+	for k, lv := range low {
+		hv, ok := high[k]
+		if !ok {
+			high[k] = lv
+			continue
+		}
+		hm, hIsObject := hv.(map[string]interface{})
+		lm, lIsObject := lv.(map[string]interface{})
+		if hIsObject && lIsObject {
+			high[k] = mergeObjects(hm, lm)
+		}
+	}
+	return high
+}
+
+// Decode a JSON object, keeping numbers as written so large integers and
+// their formatting survive the merge
+func decodeObject(value string) (map[string]interface{}, bool) {
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil || obj == nil || dec.More() {
+		return nil, false
+	}
+	return obj, true
+}
@@ -0,0 +1,36 @@
+package consul
+
+import "testing"
+
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		high   string
+		low    string
+		want   string
+		wantOK bool
+	}{
+		{name: "disjoint fields", high: `{"a":1}`, low: `{"b":2}`, want: `{"a":1,"b":2}`, wantOK: true},
+		{name: "high wins per leaf", high: `{"a":1}`, low: `{"a":2,"b":3}`, want: `{"a":1,"b":3}`, wantOK: true},
+		{name: "nested objects merge", high: `{"db":{"host":"h"}}`, low: `{"db":{"host":"x","port":5432}}`, want: `{"db":{"host":"h","port":5432}}`, wantOK: true},
+		{name: "object replaces scalar", high: `{"db":"url"}`, low: `{"db":{"host":"x"}}`, want: `{"db":"url"}`, wantOK: true},
+		{name: "large integers stay exact", high: `{"id":9007199254740993}`, low: `{"n":1.50}`, want: `{"id":9007199254740993,"n":1.50}`, wantOK: true},
+		{name: "arrays are leaves", high: `{"l":[1]}`, low: `{"l":[2,3]}`, want: `{"l":[1]}`, wantOK: true},
+		{name: "high not an object", high: `[1]`, low: `{"a":1}`},
+		{name: "low not an object", high: `{"a":1}`, low: `"text"`},
+		{name: "null", high: `null`, low: `{"a":1}`},
+		{name: "invalid JSON", high: `{"a":`, low: `{"a":1}`},
+		{name: "trailing data", high: `{"a":1} {"b":2}`, low: `{"c":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mergeJSON(tt.high, tt.low)
+			if ok != tt.wantOK {
+				t.Fatalf("mergeJSON(%s, %s) ok = %v, want %v", tt.high, tt.low, ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("mergeJSON(%s, %s) = %s, want %s", tt.high, tt.low, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// Namespaces prints every namespace with the number of keys it holds under
+// path. Namespaces only exist in Consul Enterprise.
+func Namespaces(ctx context.Context, path string) {
+	consul := connect(ctx)
+	qp := parsePath(path)
+
+	namespaces, _, err := consul.Namespaces().List(queryOptions(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		var statusErr consulapi.StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+			fail(1, "", "Namespaces are not supported by this Consul server (Enterprise only).")
+		}
+		fail(133, "", "%s", err)
+	}
+
+	for _, ns := range namespaces {
+		q := qp.options(ctx)
+		q.Namespace = ns.Name
+		keys, _, err := consul.KV().Keys(qp.path, "", q)
+		if err != nil {
+			exitOnCancel(ctx)
+			fail(133, ns.Name+":"+qp.path, "%s: %s", ns.Name, err)
+		}
+		fmt.Printf("%s\t%d\n", ns.Name, len(keys))
+	}
+}
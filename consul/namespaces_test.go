@@ -0,0 +1,78 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Enterprise server with a KV store per namespace, or without the
+// namespaces API when stores is nil
+func namespacesStub(t *testing.T, names []string, stores map[string]*consulStub) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/namespaces" {
+			if stores == nil {
+				http.NotFound(w, r)
+				return
+			}
+			var namespaces []*consulapi.Namespace
+			for _, name := range names {
+				namespaces = append(namespaces, &consulapi.Namespace{Name: name})
+			}
+			json.NewEncoder(w).Encode(namespaces)
+			return
+		}
+		stub, ok := stores[r.URL.Query().Get("ns")]
+		if !ok {
+			json.NewEncoder(w).Encode([]string{})
+			return
+		}
+		stub.serve(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestNamespaces(t *testing.T) {
+	resetConfig(t)
+	addr := namespacesStub(t, []string{"default", "team-a", "team-b"}, map[string]*consulStub{
+		"default": newConsulStub(t, "app/A", "1", "app/db/B", "2", "other/C", "3"),
+		"team-a":  newConsulStub(t, "app/A", "1"),
+	})
+	viper.Set("addr", addr)
+
+	out := captureStdout(t, func() { Namespaces(context.Background(), "app") })
+	if want := "default\t2\nteam-a\t1\nteam-b\t0\n"; out != want {
+		t.Errorf("Namespaces =\n%s\nwant\n%s", out, want)
+	}
+}
+
+// Without the namespaces API the command exits with 1, in a child process
+func TestNamespacesOSS(t *testing.T) {
+	if os.Getenv("CONSULENV_TEST_OSS") != "" {
+		viper.Set("addr", namespacesStub(t, nil, nil))
+		Namespaces(context.Background(), "app")
+		os.Exit(0)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestNamespacesOSS$")
+	cmd.Env = append(os.Environ(), "CONSULENV_TEST_OSS=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("exit %v, want 1: %s", err, out)
+	}
+	if !strings.Contains(string(out), "Enterprise only") {
+		t.Errorf("output %q, want namespaces reported unsupported", out)
+	}
+}
@@ -0,0 +1,49 @@
+package consul
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// Values available to --name-template for each key
+type nameContext struct {
+	Folder string // last segment of the queried path
+	Key    string // variable name as stored in Consul
+	Path   string // queried path, with its dc=/ns= qualifiers
+}
+
+func parseNameTemplate() (*template.Template, error) {
+	text := viper.GetString("name-template")
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("name-template").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --name-template: %s", err)
+	}
+	return tmpl, nil
+}
+
+// Variable name for key k read through path. Names that are not shell
+// identifiers are only accepted when every output is json, yaml or template.
+func templateName(tmpl *template.Template, path string, k string) (string, error) {
+	segments := strings.Split(parsePath(path).path, keySeparator())
+	ctx := nameContext{Folder: segments[len(segments)-1], Key: k, Path: path}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, ctx); err != nil {
+		return "", fmt.Errorf("--name-template on %s: %s", k, err)
+	}
+	name := b.String()
+	if name == "" {
+		return "", fmt.Errorf("--name-template gives an empty name for %s in %s", k, path)
+	}
+	if format := shellOutput(); format != "" && !varNamePattern.MatchString(name) {
+		return "", fmt.Errorf("--name-template gives %q for %s in %s, not a valid %s variable name", name, k, path, format)
+	}
+	return name, nil
+}
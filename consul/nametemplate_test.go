@@ -0,0 +1,85 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTemplateName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		path     string
+		key      string
+		json     bool
+		want     string
+		wantErr  bool
+	}{
+		{name: "folder and key", template: "{{upper .Folder}}_{{.Key}}", path: "apps/payments", key: "HOST", want: "PAYMENTS_HOST"},
+		{name: "folder of a qualified path", template: "{{upper .Folder}}_{{.Key}}", path: "dc=eu,ns=team-a:apps/svc", key: "PORT", want: "SVC_PORT"},
+		{name: "single segment path", template: "{{.Folder}}_{{.Key}}", path: "app", key: "A", want: "app_A"},
+		{name: "path with qualifiers", template: "{{.Path}}", path: "dc=eu:app", key: "A", json: true, want: "dc=eu:app"},
+		{name: "dotted name for json", template: "{{.Folder}}.{{.Key}}", path: "apps/svc", key: "host", json: true, want: "svc.host"},
+		{name: "dotted name for env", template: "{{.Folder}}.{{.Key}}", path: "apps/svc", key: "host", wantErr: true},
+		{name: "empty name", template: "{{if false}}x{{end}}", path: "app", key: "A", wantErr: true},
+		{name: "unknown field", template: "{{.Service}}", path: "app", key: "A", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("name-template", tt.template)
+			viper.Set("json", tt.json)
+			tmpl, err := parseNameTemplate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := templateName(tmpl, tt.path, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("templateName(%q, %q) error %v, want error %v", tt.path, tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("templateName(%q, %q) = %q, want %q", tt.path, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// The manifest follows renamed variables back to the key they were read from
+func TestNameTemplateManifest(t *testing.T) {
+	resetConfig(t)
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	viper.Set("path", []string{"apps/payments", "apps/common"})
+	viper.Set("name-template", "{{upper .Folder}}_{{.Key}}")
+	viper.Set("manifest", manifest)
+	f := newFetched(map[string]map[string]string{
+		"apps/payments": {"HOST": "pay"},
+		"apps/common":   {"HOST": "common"},
+	})
+
+	snap := processEnv(f)
+	if snap.env["PAYMENTS_HOST"] != "pay" || snap.env["COMMON_HOST"] != "common" {
+		t.Fatalf("env %v, want PAYMENTS_HOST and COMMON_HOST", snap.env)
+	}
+	if err := writeManifest(manifest, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries map[string]manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]string{"PAYMENTS_HOST": "apps/payments/HOST", "COMMON_HOST": "apps/common/HOST"} {
+		if entries[name].Key != key || entries[name].ModifyIndex == 0 {
+			t.Errorf("manifest entry of %s = %+v, want key %s with its index", name, entries[name], key)
+		}
+	}
+}
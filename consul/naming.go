@@ -0,0 +1,164 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Convert a name to a --naming convention, from its words
+var namingConventions = map[string]func(words []string) string{
+	"screaming_snake": func(words []string) string { return strings.ToUpper(strings.Join(words, "_")) },
+	"snake":           func(words []string) string { return strings.Join(words, "_") },
+	"kebab":           func(words []string) string { return strings.Join(words, "-") },
+	"camel":           func(words []string) string { return joinTitled(words, 1) },
+	"pascal":          func(words []string) string { return joinTitled(words, 0) },
+}
+
+// Formats whose consumers accept names that are not shell identifiers
+var freeNamingFormats = map[string]bool{"json": true, "yaml": true, "template": true}
+
+// Lower case words of a name, split on anything but letters and digits and
+// on case changes, so "dbHost", "DB_HOST", "db-host" and "DBHost" all give
+// db, host.
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+	}
+
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := word[len(word)-1]
+			// "dbHost" splits before H, "DBHost" before the H of Host
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// Join words capitalizing each from index from on
+func joinTitled(words []string, from int) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i >= from {
+			r := []rune(w)
+			r[0] = unicode.ToUpper(r[0])
+			w = string(r)
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// CheckNaming reports an unknown --naming convention, or one producing
+// names that are not valid shell identifiers for a shell-style output
+func CheckNaming() error {
+	naming := viper.GetString("naming")
+	if naming == "" {
+		return nil
+	}
+	if _, ok := namingConventions[naming]; !ok {
+		return fmt.Errorf("Invalid --naming %q, expected screaming_snake, snake, kebab, camel or pascal", naming)
+	}
+	if naming == "screaming_snake" || naming == "snake" {
+		return nil
+	}
+
+	if format := shellOutput(); format != "" {
+		return fmt.Errorf("--naming %s is only valid for json, yaml and template output, not %s", naming, format)
+	}
+	return nil
+}
+
+// First requested output format that needs shell-safe variable names,
+// empty when all are json, yaml or template
+func shellOutput() string {
+	formats := []string{outputFormat()}
+	if emits, _ := parseEmits(); len(emits) > 0 {
+		formats = nil
+		for _, e := range emits {
+			formats = append(formats, e.format)
+		}
+	}
+	for _, format := range formats {
+		if !freeNamingFormats[format] {
+			return format
+		}
+	}
+	return ""
+}
+
+// Rename the merged variables to the --naming convention. Two names
+// converting to the same one is an error rather than one silently winning.
+func applyNaming(naming string, keys []string, env map[string]string, secrets map[string]bool, sources map[string]string, winners map[string]*consulapi.KVPair, descriptions map[string]map[string]string) ([]string, error) {
+	convert := namingConventions[naming]
+
+	renamed := make([]string, 0, len(keys))
+	from := map[string]string{}
+	for _, k := range keys {
+		name := k
+		if words := nameWords(k); len(words) > 0 {
+			name = convert(words)
+		}
+		if other, ok := from[name]; ok {
+			return nil, fmt.Errorf("%q and %q are both named %s with --naming %s", other, k, name, naming)
+		}
+		from[name] = k
+		renamed = append(renamed, name)
+	}
+
+	values := make(map[string]string, len(keys))
+	flagged := make(map[string]bool, len(keys))
+	folders := make(map[string]string, len(keys))
+	pairs := make(map[string]*consulapi.KVPair, len(keys))
+	for i, k := range keys {
+		values[renamed[i]] = env[k]
+		flagged[renamed[i]] = secrets[k]
+		folders[renamed[i]] = sources[k]
+		if kvPair, ok := winners[k]; ok {
+			pairs[renamed[i]] = kvPair
+		}
+		if desc, ok := descriptions[sources[k]][k]; ok {
+			descriptions[sources[k]][renamed[i]] = desc
+		}
+	}
+	for _, m := range []map[string]string{env, sources} {
+		for k := range m {
+			delete(m, k)
+		}
+	}
+	for k := range secrets {
+		delete(secrets, k)
+	}
+	for k := range winners {
+		delete(winners, k)
+	}
+	for k, v := range values {
+		env[k] = v
+		sources[k] = folders[k]
+		if kvPair, ok := pairs[k]; ok {
+			winners[k] = kvPair
+		}
+		if flagged[k] {
+			secrets[k] = true
+		}
+	}
+	return renamed, nil
+}
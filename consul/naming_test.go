@@ -0,0 +1,100 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+func TestNameWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "DB_HOST", want: []string{"db", "host"}},
+		{name: "dbHost", want: []string{"db", "host"}},
+		{name: "db-host", want: []string{"db", "host"}},
+		{name: "DBHost", want: []string{"db", "host"}},
+		{name: "db.host_port", want: []string{"db", "host", "port"}},
+		{name: "oauth2Token", want: []string{"oauth2", "token"}},
+		{name: "HTTPServerURL", want: []string{"http", "server", "url"}},
+		{name: "__x__", want: []string{"x"}},
+		{name: "A", want: []string{"a"}},
+		{name: "_", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nameWords(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nameWords(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamingConventions(t *testing.T) {
+	words := []string{"db", "host"}
+	tests := map[string]string{
+		"screaming_snake": "DB_HOST",
+		"snake":           "db_host",
+		"kebab":           "db-host",
+		"camel":           "dbHost",
+		"pascal":          "DbHost",
+	}
+	for naming, want := range tests {
+		t.Run(naming, func(t *testing.T) {
+			if got := namingConventions[naming](words); got != want {
+				t.Errorf("%s = %q, want %q", naming, got, want)
+			}
+		})
+	}
+}
+
+func TestApplyNaming(t *testing.T) {
+	tests := []struct {
+		name    string
+		naming  string
+		keys    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "renames in order", naming: "camel", keys: []string{"DB_HOST", "PORT"}, want: []string{"dbHost", "port"}},
+		{name: "collision", naming: "snake", keys: []string{"DB_HOST", "dbHost"}, wantErr: true},
+		{name: "unchanged", naming: "screaming_snake", keys: []string{"A_B"}, want: []string{"A_B"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			secrets := map[string]bool{}
+			sources := map[string]string{}
+			winners := map[string]*consulapi.KVPair{}
+			for _, k := range tt.keys {
+				env[k] = "v-" + k
+				secrets[k] = true
+				sources[k] = "app"
+				winners[k] = &consulapi.KVPair{Key: "app/" + k}
+			}
+
+			got, err := applyNaming(tt.naming, tt.keys, env, secrets, sources, winners, map[string]map[string]string{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("names %q, want %q", got, tt.want)
+			}
+			// Values, secret flags, sources and source keys follow the rename
+			for i, name := range tt.want {
+				old := tt.keys[i]
+				if env[name] != "v-"+old || !secrets[name] || sources[name] != "app" || winners[name].Key != "app/"+old {
+					t.Errorf("%s lost what belonged to %s", name, old)
+				}
+			}
+			if len(env) != len(tt.want) || len(winners) != len(tt.want) {
+				t.Errorf("old names left behind: %v", env)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package consul
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Variables filling one machine entry when no --netrc-entry is given
+const defaultNetrcEntry = "NETRC_MACHINE,NETRC_LOGIN,NETRC_PASSWORD"
+
+// Render .netrc machine entries. Each --netrc-entry names the variables
+// holding machine, login and password, comma separated.
+func renderNetrc(w io.Writer, s *snapshot) error {
+	specs := viper.GetStringSlice("netrc-entry")
+	if len(specs) == 0 {
+		specs = []string{defaultNetrcEntry}
+	}
+
+	var b strings.Builder
+	for _, spec := range specs {
+		names := strings.Split(spec, ",")
+		if len(names) != 3 {
+			return fmt.Errorf("invalid --netrc-entry %q, expected MACHINE_VAR,LOGIN_VAR,PASSWORD_VAR", spec)
+		}
+
+		var fields [3]string
+		for i, name := range names {
+			v, ok := s.env[strings.TrimSpace(name)]
+			if !ok {
+				return fmt.Errorf("variable %s for --netrc-entry not found", name)
+			}
+			if v == "" || strings.ContainsAny(v, " \t\r\n") {
+				return fmt.Errorf("variable %s can not be used in .netrc: empty or contains whitespace", name)
+			}
+			fields[i] = v
+		}
+		fmt.Fprintf(&b, "machine %s\n  login %s\n  password %s\n", fields[0], fields[1], fields[2])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,80 @@
+package consul
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRenderNetrc(t *testing.T) {
+	env := map[string]string{
+		"NETRC_MACHINE": "api.example.com", "NETRC_LOGIN": "bot", "NETRC_PASSWORD": "s3cret",
+		"GIT_HOST": "git.example.com", "GIT_USER": "ci", "GIT_TOKEN": "t0ken",
+		"EMPTY": "", "SPACED": "two words",
+	}
+	tests := []struct {
+		name    string
+		entries []string
+		want    string
+		wantErr string
+	}{
+		{name: "default entry", want: "machine api.example.com\n  login bot\n  password s3cret\n"},
+		{
+			name:    "several entries",
+			entries: []string{"NETRC_MACHINE,NETRC_LOGIN,NETRC_PASSWORD", "GIT_HOST, GIT_USER, GIT_TOKEN"},
+			want:    "machine api.example.com\n  login bot\n  password s3cret\nmachine git.example.com\n  login ci\n  password t0ken\n",
+		},
+		{name: "missing variable", entries: []string{"GIT_HOST,GIT_USER,MISSING"}, wantErr: "MISSING for --netrc-entry not found"},
+		{name: "empty value", entries: []string{"GIT_HOST,EMPTY,GIT_TOKEN"}, wantErr: "EMPTY can not be used"},
+		{name: "whitespace", entries: []string{"GIT_HOST,GIT_USER,SPACED"}, wantErr: "SPACED can not be used"},
+		{name: "malformed entry", entries: []string{"GIT_HOST,GIT_USER"}, wantErr: "invalid --netrc-entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("netrc-entry", tt.entries)
+			var b strings.Builder
+			err := renderNetrc(&b, &snapshot{env: env})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("renderNetrc error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("renderNetrc =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+// A .netrc output file is private, even replacing a readable one
+func TestNetrcFileMode(t *testing.T) {
+	resetConfig(t)
+	file := filepath.Join(t.TempDir(), ".netrc")
+	if err := ioutil.WriteFile(file, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(file, 0644)
+
+	data := []byte("machine h\n  login l\n  password p\n")
+	writeFiles(&snapshot{}, []rendered{{emit: emit{format: "netrc", file: file}, data: data}})
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode %o, want 0600", fi.Mode().Perm())
+	}
+	if got, _ := ioutil.ReadFile(file); string(got) != string(data) {
+		t.Errorf("content %q, want %q", got, data)
+	}
+}
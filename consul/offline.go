@@ -0,0 +1,88 @@
+package consul
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Listing of one path as saved in --cache-dir
+type pathSnapshot struct {
+	Addr    string
+	Path    string
+	Scope   string // datacenter/namespace
+	Fetched time.Time
+	Pairs   consulapi.KVPairs
+}
+
+// Snapshot file of a path read from addr, in a directory per server and
+// named after its datacenter, namespace and path
+func snapshotFile(dir string, addr string, qp queryPath) string {
+	return filepath.Join(dir, url.PathEscape(addr), url.PathEscape(scope(qp.String())+":"+qp.path)+".json")
+}
+
+// Save each listing read from addr to its own file in dir, for later
+// --offline runs
+func saveSnapshots(dir string, addr string, lists []pathList) error {
+	if err := os.MkdirAll(filepath.Join(dir, url.PathEscape(addr)), 0700); err != nil {
+		return err
+	}
+	for _, list := range lists {
+		snap := pathSnapshot{
+			Addr:    addr,
+			Path:    list.path.path,
+			Scope:   scope(list.path.String()),
+			Fetched: time.Now().UTC(),
+			Pairs:   list.kvPairs,
+		}
+		data, err := json.Marshal(snap)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(snapshotFile(dir, addr, list.path), data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read the listings from the --cache-dir snapshots of addr instead of
+// Consul. A path that was never saved from addr is an error, not an empty
+// listing.
+func listOffline(dir string, addr string, qps []queryPath) ([]pathList, error) {
+	if dir == "" {
+		return nil, errors.New("--offline needs --cache-dir")
+	}
+
+	var lists []pathList
+	for _, qp := range qps {
+		file := snapshotFile(dir, addr, qp)
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no snapshot of %s from %s in %s, run once without --offline", qp, addr, dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var snap pathSnapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("reading %s: %s", file, err)
+		}
+		if snap.Addr != addr {
+			return nil, fmt.Errorf("snapshot %s was fetched from %s, not %s", file, snap.Addr, addr)
+		}
+		if viper.GetBool("verbose") {
+			fmt.Fprintf(os.Stderr, "Using snapshot of %s from %s\n", qp, snap.Fetched.Local().Format(time.RFC3339))
+		}
+		lists = append(lists, pathList{path: qp, kvPairs: snap.Pairs})
+	}
+	return lists, nil
+}
@@ -0,0 +1,83 @@
+package consul
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Listings are saved per server and replayed without querying it
+func TestOfflineReplay(t *testing.T) {
+	resetConfig(t)
+	viper.Set("cache-dir", t.TempDir())
+	viper.Set("path", []string{"app"})
+	eu := newConsulStub(t, "app/HOST", "eu")
+	us := newConsulStub(t, "app/HOST", "us")
+
+	for _, stub := range []*consulStub{eu, us} {
+		if _, err := fetchEnv(context.Background(), stub.client()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	viper.Set("offline", true)
+	for want, stub := range map[string]*consulStub{"eu": eu, "us": us} {
+		calls := stub.count("list")
+		f, err := fetchEnv(context.Background(), stub.client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(f.envMap["app"]["HOST"].Value); got != want {
+			t.Errorf("replayed HOST = %q, want %q from its own server", got, want)
+		}
+		if stub.count("list") != calls {
+			t.Errorf("offline run listed %s", stub.addr())
+		}
+	}
+}
+
+func TestOfflineMissing(t *testing.T) {
+	tests := []struct {
+		name string
+		copy bool // snapshot of the first server placed under the second
+		want string
+	}{
+		{name: "never saved from this address", want: "no snapshot of app from"},
+		{name: "snapshot of another address", copy: true, want: "was fetched from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			dir := t.TempDir()
+			viper.Set("cache-dir", dir)
+			viper.Set("path", []string{"app"})
+			saved := newConsulStub(t, "app/HOST", "h")
+			other := newConsulStub(t)
+			if _, err := fetchEnv(context.Background(), saved.client()); err != nil {
+				t.Fatal(err)
+			}
+			if tt.copy {
+				data, err := ioutil.ReadFile(snapshotFile(dir, saved.addr(), parsePath("app")))
+				if err != nil {
+					t.Fatal(err)
+				}
+				file := snapshotFile(dir, other.addr(), parsePath("app"))
+				os.MkdirAll(filepath.Dir(file), 0700)
+				if err := ioutil.WriteFile(file, data, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			viper.Set("offline", true)
+			_, err := fetchEnv(context.Background(), other.client())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package consul
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Write rendered output to file, or to stdout when no file is given. A
+// non-zero perm is forced on the file, otherwise an existing file keeps its
+// mode and new ones are private.
+func writeOutput(file string, data []byte, perm os.FileMode) error {
+	if file == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if fi, err := os.Stat(file); err == nil && fi.Mode()&(os.ModeNamedPipe|os.ModeCharDevice) != 0 {
+		return writeStream(file, data)
+	}
+	if perm != 0 {
+		return writeFileMode(file, data, perm)
+	}
+	return writeFileAtomic(file, data, 0600)
+}
+
+// Write data to a FIFO or device as is: it can not be renamed over and
+// truncating is meaningless. Opening a FIFO blocks until a reader opens it.
+func writeStream(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write data to a temporary file next to file and rename it over file, so
+// readers never see a partial write. An existing file keeps its mode, new
+// files get perm.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	if fi, err := os.Stat(file); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	return writeFileMode(file, data, perm)
+}
+
+// Atomically write data to file with perm, whatever the mode of the file it
+// replaces, so it is never readable with a wider mode in between
+func writeFileMode(file string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
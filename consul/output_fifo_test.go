@@ -0,0 +1,59 @@
+//go:build !windows
+
+package consul
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// A FIFO is streamed to as is, whether or not a mode is forced: it stays the
+// same FIFO with the same mode and no temporary file is renamed over it
+func TestWriteOutputFIFO(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "app.env")
+	if err := syscall.Mkfifo(fifo, 0620); err != nil {
+		t.Skipf("creating a FIFO: %s", err)
+	}
+	os.Chmod(fifo, 0620)
+	before, err := os.Stat(fifo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, perm := range []os.FileMode{0, 0600} {
+		read := make(chan string)
+		go func() {
+			f, err := os.Open(fifo)
+			if err != nil {
+				read <- err.Error()
+				return
+			}
+			defer f.Close()
+			data, _ := ioutil.ReadAll(f)
+			read <- string(data)
+		}()
+
+		if err := writeOutput(fifo, []byte("A=1\nB=2\n"), perm); err != nil {
+			t.Fatalf("perm %o: %s", perm, err)
+		}
+		if got := <-read; got != "A=1\nB=2\n" {
+			t.Errorf("perm %o: reader got %q, want both lines", perm, got)
+		}
+
+		after, err := os.Stat(fifo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Mode()&os.ModeNamedPipe == 0 || !os.SameFile(before, after) {
+			t.Errorf("perm %o: %s was replaced, mode %s", perm, fifo, after.Mode())
+		}
+		if after.Mode().Perm() != 0620 {
+			t.Errorf("perm %o: FIFO mode changed to %o", perm, after.Mode().Perm())
+		}
+	}
+	assertNoTempFiles(t, dir)
+}
@@ -0,0 +1,162 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode // mode of a file already there, 0 for none
+		perm     os.FileMode
+		wantMode os.FileMode
+	}{
+		{name: "new private file", perm: 0600, wantMode: 0600},
+		{name: "new shared file", perm: 0644, wantMode: 0644},
+		{name: "existing file keeps its mode", existing: 0640, perm: 0600, wantMode: 0640},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "app.env")
+			if tt.existing != 0 {
+				if err := ioutil.WriteFile(file, []byte("OLD=1\n"), tt.existing); err != nil {
+					t.Fatal(err)
+				}
+				os.Chmod(file, tt.existing)
+			}
+
+			if err := writeFileAtomic(file, []byte("NEW=1\n"), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "NEW=1\n" {
+				t.Errorf("content %q, want NEW=1", data)
+			}
+			fi, _ := os.Stat(file)
+			if fi.Mode().Perm() != tt.wantMode {
+				t.Errorf("mode %o, want %o", fi.Mode().Perm(), tt.wantMode)
+			}
+			assertNoTempFiles(t, filepath.Dir(file))
+		})
+	}
+}
+
+// A write interrupted before the rename leaves the target as it was and no
+// temporary file behind
+func TestWriteFileAtomicInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	// Renaming a file over a non-empty directory fails after the temporary
+	// file was written, like an interrupt right before the rename
+	target := filepath.Join(dir, "app.env")
+	if err := os.MkdirAll(filepath.Join(target, "keep"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(target, []byte("NEW=1\n"), 0600); err == nil {
+		t.Fatal("replacing a directory succeeded")
+	}
+	if fi, err := os.Stat(filepath.Join(target, "keep")); err != nil || !fi.IsDir() {
+		t.Errorf("target changed by the failed write: %v", err)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// --output-file replaces a regular file through a rename, keeping its mode,
+// and writes to a device in place since it can not be renamed over
+func TestWriteOutput(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.env")
+	if err := ioutil.WriteFile(file, []byte("OLD=1\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(file, 0640)
+	before, _ := os.Stat(file)
+
+	if err := writeOutput(file, []byte("NEW=1\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("file written in place, want a rename")
+	}
+	if after.Mode().Perm() != 0640 {
+		t.Errorf("mode %o, want 0640", after.Mode().Perm())
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != "NEW=1\n" {
+		t.Errorf("content %q, want NEW=1", data)
+	}
+	assertNoTempFiles(t, filepath.Dir(file))
+
+	if _, err := os.Stat(os.DevNull); err == nil {
+		if err := writeOutput(os.DevNull, []byte("NEW=1\n"), 0600); err != nil {
+			t.Errorf("writing to %s: %s", os.DevNull, err)
+		}
+	}
+}
+
+// An interrupted run exits with 130 and leaves the output file alone. The
+// run happens in a child process, as fail exits.
+func TestGetInterrupted(t *testing.T) {
+	if file := os.Getenv("CONSULENV_TEST_OUTPUT"); file != "" {
+		viper.Set("addr", "127.0.0.1:1")
+		viper.Set("path", []string{"app"})
+		viper.Set("output-file", file)
+		viper.Set("error-format", os.Getenv("CONSULENV_TEST_ERROR_FORMAT"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Get(ctx)
+		os.Exit(0)
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "text", want: "Interrupted."},
+		{format: "json", want: `{"code":130,"kind":"interrupted","message":"Interrupted."}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "app.env")
+			if err := ioutil.WriteFile(file, []byte("OLD=1\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestGetInterrupted$")
+			cmd.Env = append(os.Environ(), "CONSULENV_TEST_OUTPUT="+file, "CONSULENV_TEST_ERROR_FORMAT="+tt.format)
+			out, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+				t.Fatalf("exit %v, want 130: %s", err, out)
+			}
+			if !strings.Contains(string(out), tt.want) {
+				t.Errorf("output %q, want %s", out, tt.want)
+			}
+			if data, _ := ioutil.ReadFile(file); string(data) != "OLD=1\n" {
+				t.Errorf("output file changed to %q", data)
+			}
+		})
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, ".*.tmp*"))
+	if len(matches) > 0 {
+		t.Errorf("temporary files left behind: %q", matches)
+	}
+}
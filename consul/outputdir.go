@@ -0,0 +1,158 @@
+package consul
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+var varNamePattern = regexp.MustCompile("^[A-Za-z0-9_]*$")
+
+// File named name directly in dir, an error for names that would be written
+// anywhere else, like ones holding a separator or ..
+func outputDirFile(dir string, name string) (string, error) {
+	file := filepath.Join(dir, name)
+	if name == "" || filepath.Dir(file) != filepath.Clean(dir) {
+		return "", fmt.Errorf("%q is not a file name in %s", name, dir)
+	}
+	return file, nil
+}
+
+// Write each variable to its own file named after the key, holding the raw
+// value, atomically and readable by the owner only. With --clean, files of
+// variables not in this run are removed.
+func writeOutputDir(dir string, snap *snapshot) error {
+	if viper.GetBool("split-by-prefix") {
+		return writeSplitByPrefix(dir, snap)
+	}
+
+	newline := viper.GetBool("newline")
+
+	if err := caseCollisions("variables", snap.keys); err != nil {
+		return err
+	}
+
+	// Names may come from --name-template or --naming, nothing is written
+	// unless all of them stay in dir
+	files := make([]string, len(snap.keys))
+	for i, k := range snap.keys {
+		file, err := outputDirFile(dir, k)
+		if err != nil {
+			return err
+		}
+		files[i] = file
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	for i, k := range snap.keys {
+		data := []byte(snap.env[k])
+		if newline {
+			data = append(data, '\n')
+		}
+		if err := writeFileMode(files[i], data, 0600); err != nil {
+			return err
+		}
+	}
+
+	if viper.GetBool("clean") {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Mode().IsRegular() || !varNamePattern.MatchString(name) {
+				continue
+			}
+			if _, ok := snap.env[name]; ok {
+				continue
+			}
+			if viper.GetBool("verbose") {
+				fmt.Fprintln(os.Stderr, "Removing stale", filepath.Join(dir, name))
+			}
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Write one <component>.env file per leading COMPONENT_ segment of the
+// variable names, names without the separator go to the default bucket.
+// With --clean, other .env files are removed.
+func writeSplitByPrefix(dir string, snap *snapshot) error {
+	sep := viper.GetString("split-separator")
+	bucket := viper.GetString("split-default")
+
+	var components []string
+	groups := map[string][]string{}
+	for _, k := range snap.keys {
+		component := bucket
+		if i := strings.Index(k, sep); sep != "" && i > 0 {
+			component = strings.ToLower(k[:i])
+		}
+		if _, ok := groups[component]; !ok {
+			components = append(components, component)
+		}
+		groups[component] = append(groups[component], k)
+	}
+
+	if err := caseCollisions("variables", snap.keys); err != nil {
+		return err
+	}
+	for _, component := range components {
+		if _, err := outputDirFile(dir, component+".env"); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	for _, component := range components {
+		part := *snap
+		part.keys = groups[component]
+		part.unset = nil
+
+		var b bytes.Buffer
+		if err := renderEnv("", false)(&b, &part); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, component+".env"), b.Bytes(), 0600); err != nil {
+			return err
+		}
+	}
+
+	if viper.GetBool("clean") {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Mode().IsRegular() || !strings.HasSuffix(name, ".env") {
+				continue
+			}
+			if _, ok := groups[strings.TrimSuffix(name, ".env")]; ok {
+				continue
+			}
+			if viper.GetBool("verbose") {
+				fmt.Fprintln(os.Stderr, "Removing stale", filepath.Join(dir, name))
+			}
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package consul
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWriteOutputDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		newline bool
+		clean   bool
+		want    map[string]string // files in the directory afterwards
+	}{
+		{name: "raw values", want: map[string]string{"A": "1", "B": "two\nlines", "STALE": "old"}},
+		{name: "newline", newline: true, want: map[string]string{"A": "1\n", "B": "two\nlines\n", "STALE": "old"}},
+		{name: "clean", clean: true, want: map[string]string{"A": "1", "B": "two\nlines"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("newline", tt.newline)
+			viper.Set("clean", tt.clean)
+			dir := t.TempDir()
+			// An existing, world readable file does not keep its mode
+			if err := ioutil.WriteFile(filepath.Join(dir, "A"), []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "STALE"), []byte("old"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			snap := &snapshot{keys: []string{"A", "B"}, env: map[string]string{"A": "1", "B": "two\nlines"}}
+
+			if err := writeOutputDir(dir, snap); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := ioutil.ReadDir(dir)
+			if len(entries) != len(tt.want) {
+				t.Errorf("%d files, want %v", len(entries), tt.want)
+			}
+			for name, want := range tt.want {
+				file := filepath.Join(dir, name)
+				data, err := ioutil.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+				if fi, _ := os.Stat(file); name != "STALE" && fi.Mode().Perm() != 0600 {
+					t.Errorf("%s has mode %o, want 600", name, fi.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+// Names from --name-template or --naming never write outside the directory
+func TestWriteOutputDirEscape(t *testing.T) {
+	for _, name := range []string{"../ESCAPED", "sub/A", "..", "."} {
+		t.Run(name, func(t *testing.T) {
+			resetConfig(t)
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "out")
+			snap := &snapshot{keys: []string{"A", name}, env: map[string]string{"A": "1", name: "x"}}
+
+			if err := writeOutputDir(dir, snap); err == nil {
+				t.Errorf("%q written", name)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("files written before rejecting %q", name)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "ESCAPED")); !os.IsNotExist(err) {
+				t.Errorf("file written outside %s", dir)
+			}
+		})
+	}
+}
+
+func TestWriteSplitByPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		sep    string
+		bucket string
+		want   map[string]string
+	}{
+		{
+			name: "components", sep: "_", bucket: "default",
+			want: map[string]string{
+				"web.env":     "WEB_PORT=\"80\"\nWEB__HOST=\"h\"\n",
+				"worker.env":  "WORKER_THREADS=\"4\"\n",
+				"default.env": "DEBUG=\"1\"\n_HIDDEN=\"x\"\n",
+			},
+		},
+		{
+			name: "separator and bucket", sep: "__", bucket: "common",
+			want: map[string]string{
+				"web.env":    "WEB__HOST=\"h\"\n",
+				"common.env": "WEB_PORT=\"80\"\nWORKER_THREADS=\"4\"\nDEBUG=\"1\"\n_HIDDEN=\"x\"\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("split-separator", tt.sep)
+			viper.Set("split-default", tt.bucket)
+			dir := filepath.Join(t.TempDir(), "out")
+			snap := &snapshot{
+				keys: []string{"WEB_PORT", "WEB__HOST", "WORKER_THREADS", "DEBUG", "_HIDDEN"},
+				env:  map[string]string{"WEB_PORT": "80", "WEB__HOST": "h", "WORKER_THREADS": "4", "DEBUG": "1", "_HIDDEN": "x"},
+			}
+
+			if err := writeSplitByPrefix(dir, snap); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := ioutil.ReadDir(dir)
+			if len(entries) != len(tt.want) {
+				t.Errorf("%d files, want %v", len(entries), tt.want)
+			}
+			for name, want := range tt.want {
+				data, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Leading dc=...,ns=...: qualifiers of a path
+var qualifierPattern = regexp.MustCompile(`^((dc|ns)=[^,:=]*)(,(dc|ns)=[^,:=]*)*:`)
+
+// Path to query with its own datacenter/namespace, empty ones use the
+// global --datacenter/--namespace
+type queryPath struct {
+	path       string
+	datacenter string
+	namespace  string
+}
+
+// Parse "dc=eu,ns=team-a:apps/svc" style paths, plain paths have no qualifiers
+func parsePath(s string) queryPath {
+	var qp queryPath
+	if q := qualifierPattern.FindString(s); q != "" {
+		for _, pair := range strings.Split(strings.TrimSuffix(q, ":"), ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			switch kv[0] {
+			case "dc":
+				qp.datacenter = kv[1]
+			case "ns":
+				qp.namespace = kv[1]
+			}
+		}
+		s = strings.TrimPrefix(s, q)
+	}
+	qp.path = strings.Trim(s, "/"+keySeparator())
+	return qp
+}
+
+// Qualifier prefix in canonical form, empty for plain paths
+func (qp queryPath) qualifier() string {
+	var parts []string
+	if qp.datacenter != "" {
+		parts = append(parts, "dc="+qp.datacenter)
+	}
+	if qp.namespace != "" {
+		parts = append(parts, "ns="+qp.namespace)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, ",") + ":"
+}
+
+// Canonical form, also used to key folders fetched through this path
+func (qp queryPath) String() string {
+	return qp.qualifier() + qp.path
+}
+
+// Query options for the path, falling back to the global datacenter/namespace
+func (qp queryPath) options(ctx context.Context) *consulapi.QueryOptions {
+	q := queryOptions(ctx)
+	if qp.datacenter != "" {
+		q.Datacenter = qp.datacenter
+	}
+	if qp.namespace != "" {
+		q.Namespace = qp.namespace
+	}
+	if token := pathToken(qp.path); token != "" {
+		q.Token = token
+	}
+	return q
+}
+
+// Token from the --path-token prefix=token mapping with the longest prefix
+// containing path, empty to use the global token
+func pathToken(path string) string {
+	var token string
+	longest := -1
+	for _, mapping := range viper.GetStringSlice("path-token") {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		prefix := strings.Trim(parts[0], "/")
+		if inPath(path, prefix) && len(prefix) > longest {
+			token = parts[1]
+			longest = len(prefix)
+		}
+	}
+	return token
+}
+
+// Effective datacenter and namespace of a --path value
+func scope(s string) string {
+	qp := parsePath(s)
+	datacenter, namespace := qp.datacenter, qp.namespace
+	if datacenter == "" {
+		datacenter = viper.GetString("datacenter")
+	}
+	if namespace == "" {
+		namespace = viper.GetString("namespace")
+	}
+	return datacenter + "/" + namespace
+}
+
+// Canonical form of a --path value
+func normalizePath(s string) string {
+	return parsePath(s).String()
+}
+
+func globalQueryOptions(q *consulapi.QueryOptions) *consulapi.QueryOptions {
+	q.Datacenter = viper.GetString("datacenter")
+	q.Namespace = viper.GetString("namespace")
+	return q
+}
+
+// Values available to --path-template
+type pathContext struct {
+	Dir    string // base name of the working directory
+	Branch string // current git branch, empty outside a git repository
+}
+
+func (pathContext) Env(name string) string {
+	return os.Getenv(name)
+}
+
+func gitBranch() string {
+	out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		if viper.GetBool("verbose") {
+			fmt.Fprintln(os.Stderr, "Not in a git repository, {{.Branch}} is empty")
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func renderPathTemplate(text string, ctx pathContext) (string, error) {
+	tmpl, err := template.New("path-template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, ctx); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Paths built from --service and --env: the --service-path-template path
+// first, then each --service-base-template
+func servicePaths(service string, env string) ([]string, error) {
+	data := map[string]string{"service": service, "env": env}
+	texts := append([]string{viper.GetString("service-path-template")}, viper.GetStringSlice("service-base-template")...)
+
+	var paths []string
+	for _, text := range texts {
+		tmpl, err := template.New("service-path").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		paths = append(paths, b.String())
+	}
+	return paths, nil
+}
+
+var (
+	pathsOnce sync.Once
+	paths     []string
+)
+
+// Paths to query in precedence order: --path values with $VAR expanded, or
+// the paths composed from --service and --env when there are none, followed
+// by the path built from --path-template, all under --prefix. Keys named
+// with --get-key replace them with their folders. Resolved once per run.
+func Paths() []string {
+	pathsOnce.Do(func() {
+		for _, p := range viper.GetStringSlice("path") {
+			expanded, err := expandPathEnv(p, viper.GetBool("strict"))
+			if err != nil {
+				fail(1, "", "Invalid --path %q: %s", p, err)
+			}
+			paths = append(paths, expanded)
+		}
+
+		if service := viper.GetString("service"); len(paths) == 0 && service != "" {
+			p, err := servicePaths(service, viper.GetString("env"))
+			if err != nil {
+				fail(1, "", "Invalid --service-path-template: %s", err)
+			}
+			paths = p
+		}
+
+		if text := viper.GetString("path-template"); text != "" {
+			ctx := pathContext{Branch: gitBranch()}
+			if wd, err := os.Getwd(); err == nil {
+				ctx.Dir = filepath.Base(wd)
+			}
+			p, err := renderPathTemplate(text, ctx)
+			if err != nil {
+				fail(1, "", "Invalid --path-template: %s", err)
+			}
+			paths = append(paths, p)
+		}
+
+		if prefix := viper.GetString("prefix"); prefix != "" {
+			prefixed := make([]string, len(paths))
+			for i, p := range paths {
+				prefixed[i] = prefixPath(prefix, p)
+			}
+			paths = prefixed
+		}
+
+		if keys := namedKeys(); len(keys) > 0 {
+			paths = namedKeyFolders(keys)
+		}
+	})
+	return paths
+}
+
+// Expand $VAR and ${VAR} in a --path from the environment. Undefined
+// variables expand to empty, or are an error with strict.
+func expandPathEnv(p string, strict bool) (string, error) {
+	var undefined []string
+	expanded := os.Expand(p, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return v
+	})
+	if strict && len(undefined) > 0 {
+		return "", fmt.Errorf("undefined environment variables %s", strings.Join(undefined, ", "))
+	}
+	return expanded, nil
+}
+
+// Join --prefix and a path under it with a single slash, keeping the
+// path's dc=/ns= qualifiers in front
+func prefixPath(prefix string, s string) string {
+	q := qualifierPattern.FindString(s)
+	rest := strings.Trim(strings.TrimPrefix(s, q), "/")
+	prefix = strings.Trim(prefix, "/")
+	if rest == "" {
+		return q + prefix
+	}
+	return q + prefix + "/" + rest
+}
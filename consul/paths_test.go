@@ -0,0 +1,281 @@
+package consul
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in         string
+		path       string
+		datacenter string
+		namespace  string
+		canonical  string
+	}{
+		{in: "apps/svc", path: "apps/svc", canonical: "apps/svc"},
+		{in: "/apps/svc/", path: "apps/svc", canonical: "apps/svc"},
+		{in: "dc=eu:apps/svc", path: "apps/svc", datacenter: "eu", canonical: "dc=eu:apps/svc"},
+		{in: "ns=team-a:apps/svc", path: "apps/svc", namespace: "team-a", canonical: "ns=team-a:apps/svc"},
+		{in: "dc=eu,ns=team-a:apps/svc", path: "apps/svc", datacenter: "eu", namespace: "team-a", canonical: "dc=eu,ns=team-a:apps/svc"},
+		{in: "ns=team-a,dc=eu:/apps/svc", path: "apps/svc", datacenter: "eu", namespace: "team-a", canonical: "dc=eu,ns=team-a:apps/svc"},
+		{in: "apps/dc=eu:svc", path: "apps/dc=eu:svc", canonical: "apps/dc=eu:svc"},
+		{in: "region=eu:apps", path: "region=eu:apps", canonical: "region=eu:apps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			resetConfig(t)
+			qp := parsePath(tt.in)
+			if qp.path != tt.path || qp.datacenter != tt.datacenter || qp.namespace != tt.namespace {
+				t.Errorf("parsePath(%q) = %+v, want path %q dc %q ns %q", tt.in, qp, tt.path, tt.datacenter, tt.namespace)
+			}
+			if got := qp.String(); got != tt.canonical {
+				t.Errorf("String() = %q, want %q", got, tt.canonical)
+			}
+		})
+	}
+}
+
+func TestPathOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		datacenter string // --datacenter
+		namespace  string // --namespace
+		wantDC     string
+		wantNS     string
+		wantScope  string
+	}{
+		{name: "plain path uses the defaults", path: "apps", datacenter: "us", namespace: "default", wantDC: "us", wantNS: "default", wantScope: "us/default"},
+		{name: "dc overrides the default", path: "dc=eu:apps", datacenter: "us", namespace: "default", wantDC: "eu", wantNS: "default", wantScope: "eu/default"},
+		{name: "ns overrides the default", path: "ns=team-a:apps", datacenter: "us", wantDC: "us", wantNS: "team-a", wantScope: "us/team-a"},
+		{name: "both override", path: "dc=eu,ns=team-a:apps", datacenter: "us", namespace: "default", wantDC: "eu", wantNS: "team-a", wantScope: "eu/team-a"},
+		{name: "no defaults", path: "apps", wantScope: "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("datacenter", tt.datacenter)
+			viper.Set("namespace", tt.namespace)
+
+			q := parsePath(tt.path).options(context.Background())
+			if q.Datacenter != tt.wantDC || q.Namespace != tt.wantNS {
+				t.Errorf("options(%q) dc %q ns %q, want dc %q ns %q", tt.path, q.Datacenter, q.Namespace, tt.wantDC, tt.wantNS)
+			}
+			if got := scope(tt.path); got != tt.wantScope {
+				t.Errorf("scope(%q) = %q, want %q", tt.path, got, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestMixedQualifiedPaths(t *testing.T) {
+	resetConfig(t)
+	viper.Set("path", []string{"dc=eu:apps/svc", "apps/svc", "ns=team-a:apps", "dc=eu:apps/svc/db"})
+
+	got := pathsToQuery(Paths())
+	want := map[string]bool{"dc=eu:apps/svc": true, "apps/svc": true, "ns=team-a:apps": true}
+	if len(got) != len(want) {
+		t.Fatalf("pathsToQuery = %q, want %d paths", got, len(want))
+	}
+	for _, p := range got {
+		if !want[p] {
+			t.Errorf("unexpected path %q to query", p)
+		}
+	}
+}
+
+func TestFetchQualifiedPaths(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1", "app/db/B", "2")
+	viper.Set("path", []string{"dc=eu:app", "app", "ns=team-a:app/db"})
+
+	f, err := fetchEnv(context.Background(), stub.client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, folder := range []string{"dc=eu:app", "dc=eu:app/db", "app", "app/db", "ns=team-a:app/db"} {
+		if len(f.envMap[folder]) == 0 {
+			t.Errorf("no variables in folder %q, folders are keyed by their qualified path", folder)
+		}
+	}
+	if got := stub.count("list"); got != 3 {
+		t.Errorf("%d lists, want one per scope", got)
+	}
+}
+
+func TestPrefixPath(t *testing.T) {
+	tests := []struct {
+		prefix string
+		path   string
+		want   string
+	}{
+		{prefix: "teams/payments", path: "apps/svc", want: "teams/payments/apps/svc"},
+		{prefix: "/teams/payments/", path: "/apps/svc/", want: "teams/payments/apps/svc"},
+		{prefix: "teams", path: "", want: "teams"},
+		{prefix: "teams", path: "dc=eu:apps", want: "dc=eu:teams/apps"},
+		{prefix: "teams", path: "dc=eu,ns=a:/apps", want: "dc=eu,ns=a:teams/apps"},
+		{prefix: "teams", path: "ns=a:", want: "ns=a:teams"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+"+"+tt.path, func(t *testing.T) {
+			if got := prefixPath(tt.prefix, tt.path); got != tt.want {
+				t.Errorf("prefixPath(%q, %q) = %q, want %q", tt.prefix, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixPaths(t *testing.T) {
+	resetConfig(t)
+	viper.Set("prefix", "teams")
+	viper.Set("path", []string{"apps", "dc=eu:apps/svc"})
+	if got, want := Paths(), []string{"teams/apps", "dc=eu:teams/apps/svc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths() = %q, want %q", got, want)
+	}
+	// The configured paths themselves are left alone
+	if got := viper.GetStringSlice("path"); got[0] != "apps" {
+		t.Errorf("--path changed to %q", got)
+	}
+
+	viper.Set("get-key", []string{"apps/A"})
+	if got, want := namedKeys(), []string{"teams/apps/A"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("namedKeys() = %q, want %q", got, want)
+	}
+}
+
+func TestExpandPathEnv(t *testing.T) {
+	t.Setenv("CONSULENV_TEST_ENV", "prod")
+	t.Setenv("CONSULENV_TEST_EMPTY", "")
+	tests := []struct {
+		path    string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{path: "apps/$CONSULENV_TEST_ENV/svc", want: "apps/prod/svc"},
+		{path: "apps/${CONSULENV_TEST_ENV}-eu", want: "apps/prod-eu"},
+		{path: "apps/svc", strict: true, want: "apps/svc"},
+		{path: "apps/$CONSULENV_TEST_UNDEFINED/svc", want: "apps//svc"},
+		{path: "apps/$CONSULENV_TEST_UNDEFINED/svc", strict: true, wantErr: true},
+		{path: "apps/${CONSULENV_TEST_EMPTY}svc", strict: true, want: "apps/svc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := expandPathEnv(tt.path, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandPathEnv(%q, %v) error %v, want error %v", tt.path, tt.strict, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandPathEnv(%q, %v) = %q, want %q", tt.path, tt.strict, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPathTemplate(t *testing.T) {
+	t.Setenv("CONSULENV_TEST_STAGE", "prod")
+	tests := []struct {
+		text    string
+		ctx     pathContext
+		want    string
+		wantErr bool
+	}{
+		{text: "apps/{{.Dir}}/{{.Branch}}", ctx: pathContext{Dir: "svc", Branch: "main"}, want: "apps/svc/main"},
+		{text: `apps/{{.Dir}}/{{.Env "CONSULENV_TEST_STAGE"}}`, ctx: pathContext{Dir: "svc"}, want: "apps/svc/prod"},
+		{text: `apps/{{.Env "CONSULENV_TEST_UNSET"}}`, want: "apps/"},
+		{text: "apps/{{.Dir}}/{{or .Branch \"default\"}}", ctx: pathContext{Dir: "svc"}, want: "apps/svc/default"},
+		{text: "apps/{{.Missing}}", wantErr: true},
+		{text: "apps/{{.Dir", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := renderPathTemplate(tt.text, tt.ctx)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("renderPathTemplate(%q) = %q, %v, want %q", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+// The template path comes after the --path values, with the branch of the
+// repository in the working directory, or none outside of one
+func TestPathTemplate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tests := []struct {
+		name string
+		git  bool
+		want []string
+	}{
+		{name: "git repository", git: true, want: []string{"shared", "apps/svc/feature"}},
+		{name: "no repository", want: []string{"shared", "apps/svc/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			dir := filepath.Join(t.TempDir(), "svc")
+			if err := os.Mkdir(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(dir)
+			t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+			if tt.git {
+				for _, args := range [][]string{
+					{"init", "-q", "-b", "feature"},
+					{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+				} {
+					if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+						t.Skipf("git %s: %s %s", args[0], err, out)
+					}
+				}
+			}
+			viper.Set("path", []string{"shared"})
+			viper.Set("path-template", "apps/{{.Dir}}/{{.Branch}}")
+
+			if got := Paths(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Paths() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// --service and --env compose the paths, most specific first, unless --path
+// is given
+func TestServicePaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  []string
+		bases []string
+		want  []string
+	}{
+		{name: "service and env", want: []string{"apps/api/prod"}},
+		{name: "shared bases", bases: []string{"apps/{{.service}}/common", "shared/{{.env}}"}, want: []string{"apps/api/prod", "apps/api/common", "shared/prod"}},
+		{name: "explicit path wins", path: []string{"custom/api"}, bases: []string{"apps/{{.service}}/common"}, want: []string{"custom/api"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("service", "api")
+			viper.Set("env", "prod")
+			viper.Set("service-path-template", "apps/{{.service}}/{{.env}}")
+			viper.Set("service-base-template", tt.bases)
+			viper.Set("path", tt.path)
+
+			if got := Paths(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Paths() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	resetConfig(t)
+	viper.Set("service-path-template", "apps/{{.service}}/{{.region}}")
+	if _, err := servicePaths("api", "prod"); err == nil {
+		t.Error("template with an unknown field composed a path")
+	}
+}
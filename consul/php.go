@@ -0,0 +1,46 @@
+package consul
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var phpEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// Render variables as a PHP config file returning an array
+func renderPHP(w io.Writer, s *snapshot) error {
+	var b strings.Builder
+	b.WriteString("<?php\n\nreturn [\n")
+	for _, k := range s.keys {
+		fmt.Fprintf(&b, "    '%s' => '%s',\n", phpEscaper.Replace(k), phpEscaper.Replace(s.env[k]))
+	}
+	b.WriteString("];\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Values Laravel reads the same without quotes
+var laravelPlainPattern = regexp.MustCompile(`^[A-Za-z0-9_./:@,+-]*$`)
+
+var laravelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+
+// Render a Laravel .env file. Values with spaces, # or other special
+// characters are double quoted, with $ escaped so they are not
+// interpolated by phpdotenv.
+func renderLaravelEnv(w io.Writer, s *snapshot) error {
+	var b strings.Builder
+	for _, k := range s.keys {
+		if desc := s.description(k); desc != "" {
+			writeComment(&b, desc)
+		}
+		v := s.env[k]
+		if !laravelPlainPattern.MatchString(v) {
+			v = `"` + laravelEscaper.Replace(v) + `"`
+		}
+		fmt.Fprintf(&b, "%s=%s\n", k, v)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
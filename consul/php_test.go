@@ -0,0 +1,71 @@
+package consul
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPHP(t *testing.T) {
+	s := &snapshot{
+		keys: []string{"A", "QUOTE", "PATH"},
+		env:  map[string]string{"A": "1", "QUOTE": "it's", "PATH": `C:\dir`},
+	}
+	var b strings.Builder
+	if err := renderPHP(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	want := "<?php\n\nreturn [\n" +
+		"    'A' => '1',\n" +
+		"    'QUOTE' => 'it\\'s',\n" +
+		"    'PATH' => 'C:\\\\dir',\n" +
+		"];\n"
+	if b.String() != want {
+		t.Errorf("renderPHP = %q, want %q", b.String(), want)
+	}
+}
+
+func TestRenderLaravelEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "plain", want: "K=plain"},
+		{value: "redis://h:6379/0", want: "K=redis://h:6379/0"},
+		{value: "", want: "K="},
+		{value: "two words", want: `K="two words"`},
+		{value: "a#b", want: `K="a#b"`},
+		{value: "pa$$", want: `K="pa\$\$"`},
+		{value: `say "hi"`, want: `K="say \"hi\""`},
+		{value: "a\nb", want: `K="a\nb"`},
+		{value: `C:\dir`, want: `K="C:\\dir"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			s := &snapshot{keys: []string{"K"}, env: map[string]string{"K": tt.value}}
+			var b strings.Builder
+			if err := renderLaravelEnv(&b, s); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSuffix(b.String(), "\n"); got != tt.want {
+				t.Errorf("renderLaravelEnv(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderLaravelEnvDescriptions(t *testing.T) {
+	s := &snapshot{
+		keys:         []string{"A", "B"},
+		env:          map[string]string{"A": "1", "B": "2"},
+		sources:      map[string]string{"A": "app", "B": "app"},
+		descriptions: map[string]map[string]string{"app": {"A": "first line\nsecond line"}},
+	}
+	var b strings.Builder
+	if err := renderLaravelEnv(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	want := "# first line\n# second line\nA=1\nB=2\n"
+	if b.String() != want {
+		t.Errorf("renderLaravelEnv = %q, want %q", b.String(), want)
+	}
+}
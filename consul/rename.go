@@ -0,0 +1,118 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// Most operations Consul accepts in one transaction
+const maxTxnOps = 64
+
+// Pairs stored at prefix itself or below it, not at siblings sharing the
+// same leading characters
+func subtree(kvPairs consulapi.KVPairs, prefix string) consulapi.KVPairs {
+	var pairs consulapi.KVPairs
+	for _, kvPair := range kvPairs {
+		if kvPair.Key == prefix || strings.HasPrefix(kvPair.Key, prefix+keySeparator()) {
+			pairs = append(pairs, kvPair)
+		}
+	}
+	return pairs
+}
+
+// Rename moves the key or subtree at src to dst. Each key is created at dst
+// and deleted at src in the same transaction, checked against the index it
+// was listed at, so a rename never overwrites a destination key or loses a
+// source key changed in the meantime. Trees too large for one transaction
+// move in several. With dryRun only the moves are printed.
+func Rename(ctx context.Context, src string, dst string, dryRun bool) {
+	from, to := parsePath(src), parsePath(dst)
+	if from.path == "" || to.path == "" {
+		fail(1, "", "Source and destination must not be empty.")
+	}
+	if to.datacenter != from.datacenter {
+		fail(1, "", "rename can not span datacenters, use the same dc= qualifier.")
+	}
+	if inPath(to.path, from.path) || inPath(from.path, to.path) {
+		fail(1, "", "Source and destination must not contain each other.")
+	}
+
+	consul := connect(ctx)
+	kv := consul.KV()
+
+	kvPairs, _, err := kv.List(from.path, from.options(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, "", "%s", err)
+	}
+	kvPairs = subtree(kvPairs, from.path)
+	if len(kvPairs) == 0 {
+		fail(136, src, "Key not found: %s", src)
+	}
+
+	for _, kvPair := range kvPairs {
+		fmt.Fprintf(os.Stderr, "%s -> %s\n", kvPair.Key, to.path+strings.TrimPrefix(kvPair.Key, from.path))
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "-- %d keys would be renamed --\n", len(kvPairs))
+		return
+	}
+
+	if err := moveTree(ctx, consul, kvPairs, from, to); err != nil {
+		exitOnCancel(ctx)
+		fail(133, "", "%s", err)
+	}
+	fmt.Fprintf(os.Stderr, "-- %d keys renamed --\n", len(kvPairs))
+}
+
+func moveTree(ctx context.Context, consul *consulapi.Client, kvPairs consulapi.KVPairs, from queryPath, to queryPath) error {
+	fromOpts, toOpts := from.options(ctx), to.options(ctx)
+
+	batch := maxTxnOps / 2
+	if len(kvPairs) > batch {
+		fmt.Fprintf(os.Stderr, "%d keys do not fit in one transaction, renaming in %d\n", len(kvPairs), (len(kvPairs)+batch-1)/batch)
+	}
+	for len(kvPairs) > 0 {
+		n := batch
+		if len(kvPairs) < n {
+			n = len(kvPairs)
+		}
+
+		var ops consulapi.TxnOps
+		for _, kvPair := range kvPairs[:n] {
+			ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{
+				Verb:      consulapi.KVCAS,
+				Key:       to.path + strings.TrimPrefix(kvPair.Key, from.path),
+				Value:     kvPair.Value,
+				Flags:     kvPair.Flags,
+				Index:     0,
+				Namespace: toOpts.Namespace,
+			}})
+			ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{
+				Verb:      consulapi.KVDeleteCAS,
+				Key:       kvPair.Key,
+				Index:     kvPair.ModifyIndex,
+				Namespace: fromOpts.Namespace,
+			}})
+		}
+
+		ok, resp, _, err := consul.Txn().Txn(ops, fromOpts)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			var msgs []string
+			for _, e := range resp.Errors {
+				msgs = append(msgs, e.What)
+			}
+			return errors.New("transaction failed: " + strings.Join(msgs, "; "))
+		}
+		kvPairs = kvPairs[n:]
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSubtree(t *testing.T) {
+	resetConfig(t)
+	viper.Set("key-separator", ".")
+	stub := newConsulStub(t, "app", "0", "app.A", "1", "app.db.B", "2", "apple.C", "3", "app/D", "4")
+	var keys []string
+	for _, kvPair := range subtree(stub.tree(""), "app") {
+		keys = append(keys, kvPair.Key)
+	}
+	if want := []string{"app", "app.A", "app.db.B"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("subtree = %q, want %q", keys, want)
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name string
+		keys int
+		txns int
+	}{
+		{name: "one transaction", keys: 3, txns: 1},
+		{name: "several transactions", keys: 70, txns: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "apple/X", "x")
+			for i := 0; i < tt.keys; i++ {
+				stub.put(fmt.Sprintf("app/db/K%02d", i), fmt.Sprint(i), uint64(i))
+			}
+			viper.Set("addr", stub.addr())
+
+			captureStderr(t, func() { Rename(context.Background(), "app", "svc", false) })
+
+			if got := stub.count("txn"); got != tt.txns {
+				t.Errorf("%d transactions, want %d", got, tt.txns)
+			}
+			if got := stub.count("put"); got != 0 {
+				t.Errorf("%d puts outside a transaction", got)
+			}
+			for i := 0; i < tt.keys; i++ {
+				if _, ok := stub.value(fmt.Sprintf("app/db/K%02d", i)); ok {
+					t.Errorf("app/db/K%02d still there", i)
+				}
+				if v, ok := stub.value(fmt.Sprintf("svc/db/K%02d", i)); !ok || v != fmt.Sprint(i) {
+					t.Errorf("svc/db/K%02d = %q, want %d", i, v, i)
+				}
+			}
+			if v, _ := stub.value("apple/X"); v != "x" {
+				t.Error("sibling apple/X was moved")
+			}
+		})
+	}
+}
+
+func TestRenameDryRun(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1")
+	viper.Set("addr", stub.addr())
+
+	captureStderr(t, func() { Rename(context.Background(), "app", "svc", true) })
+
+	if stub.count("txn") != 0 {
+		t.Error("dry run wrote to Consul")
+	}
+	if _, ok := stub.value("app/A"); !ok {
+		t.Error("dry run moved app/A")
+	}
+}
+
+// A destination key that exists or a source key changed since it was listed
+// fails the whole transaction and leaves both trees as they were
+func TestMoveTreeConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *consulStub)
+	}{
+		{name: "destination exists", change: func(s *consulStub) { s.put("svc/B", "taken", 0) }},
+		{name: "source changed", change: func(s *consulStub) { s.put("app/B", "changed", 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "app/A", "1", "app/B", "2")
+			kvPairs := stub.tree("app")
+			stub.mu.Lock()
+			tt.change(stub)
+			stub.mu.Unlock()
+			before := stub.tree("")
+
+			err := moveTree(context.Background(), stub.client(), kvPairs, parsePath("app"), parsePath("svc"))
+			if err == nil {
+				t.Fatal("conflicting rename succeeded")
+			}
+			if after := stub.tree(""); !reflect.DeepEqual(after, before) {
+				t.Errorf("KV changed by a failed rename: %v", after)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Merged result of one fetch, every output format is rendered from it
+type snapshot struct {
+	envMap  map[string]map[string]*consulapi.KVPair // kv pairs per Consul folder
+	paths   []string                                // queried paths in precedence order
+	keys    []string                                // merged variable names in output order
+	env     map[string]string                       // merged variables
+	secrets map[string]bool                         // variables flagged as secret
+	sources map[string]string                       // folder each merged variable came from
+	winners map[string]*consulapi.KVPair            // kv pair each merged variable was read from
+
+	descriptions map[string]map[string]string // --with-descriptions text per folder and key
+	unset        []string                     // baseline variables no longer in Consul
+	maxIndex     uint64                       // highest ModifyIndex listed
+	skipped      int                          // keys skipped for invalid names
+	filtered     int                          // keys dropped by index, flags, exclusion or size
+	encodings    map[string]string            // --binary-as encoding per full key
+	addrs        map[string]string            // server of each variable, --addr when unset
+}
+
+// Description of merged variable k, from the folder it was taken from
+func (s *snapshot) description(k string) string {
+	return s.descriptions[s.sources[k]][k]
+}
+
+// Write text as # comment lines
+func writeComment(w io.Writer, text string) error {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if _, err := fmt.Fprintf(w, "# %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const maskedValue = "***"
+
+// Copy of the snapshot with secret values masked and --redact-pattern
+// matches replaced, for diagnostic output only
+func (s *snapshot) masked() *snapshot {
+	m := *s
+	m.env = make(map[string]string, len(s.env))
+	for k, v := range s.env {
+		if s.secrets[k] {
+			v = maskedValue
+		}
+		m.env[k] = redact(v)
+	}
+	return &m
+}
+
+var (
+	redactOnce    sync.Once
+	redactRegexps []*regexp.Regexp
+)
+
+// Replace substrings matching any --redact-pattern with the mask
+func redact(v string) string {
+	redactOnce.Do(func() {
+		for _, pattern := range viper.GetStringSlice("redact-pattern") {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				fail(1, "", "Invalid --redact-pattern %q: %s", pattern, err)
+			}
+			redactRegexps = append(redactRegexps, re)
+		}
+	})
+	for _, re := range redactRegexps {
+		v = re.ReplaceAllString(v, maskedValue)
+	}
+	return v
+}
+
+type renderer func(w io.Writer, s *snapshot) error
+
+var renderers = map[string]renderer{
+	"env":      renderEnv("", true),
+	"dotenv":   renderEnv("", false),
+	"export":   renderEnv("export ", true),
+	"json":     renderJSON,
+	"yaml":     renderYAML,
+	"ini":      renderINI,
+	"ssm":      renderSSM,
+	"vault-kv": renderVaultKV,
+	"netrc":    renderNetrc,
+	"php":      renderPHP,
+	"laravel":  renderLaravelEnv,
+	"direnv":   renderDirenv,
+	"template": renderTemplate,
+}
+
+// Format selected by the output flags
+func outputFormat() string {
+	switch {
+	case viper.GetString("template-file") != "":
+		return "template"
+	case viper.GetBool("json"):
+		return "json"
+	case viper.GetBool("yaml"):
+		return "yaml"
+	case viper.GetBool("ini"):
+		return "ini"
+	case viper.GetBool("ssm"):
+		return "ssm"
+	case viper.GetBool("vault-kv"):
+		return "vault-kv"
+	case viper.GetBool("netrc"):
+		return "netrc"
+	case viper.GetBool("php"):
+		return "php"
+	case viper.GetBool("laravel-env"):
+		return "laravel"
+	case viper.GetBool("direnv"):
+		return "direnv"
+	case viper.GetBool("export"):
+		return "export"
+	}
+	return "env"
+}
+
+type emit struct {
+	format string
+	file   string // empty for stdout
+}
+
+// Parse --emit format:path specifications
+func parseEmits() ([]emit, error) {
+	var emits []emit
+	for _, spec := range viper.GetStringSlice("emit") {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid --emit %q, expected format:path", spec)
+		}
+		if _, ok := renderers[parts[0]]; !ok {
+			return nil, fmt.Errorf("Unknown --emit format %q, expected one of: %s", parts[0], strings.Join(rendererNames(), ", "))
+		}
+		file := parts[1]
+		if file == "-" {
+			file = ""
+		}
+		emits = append(emits, emit{format: parts[0], file: file})
+	}
+	return emits, nil
+}
+
+func rendererNames() []string {
+	var names []string
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Variables grouped by the folder they were taken from, folders in
+// precedence order and keys sorted within each
+func (s *snapshot) folderGroups() ([]string, map[string][]string) {
+	var folders []string
+	groups := map[string][]string{}
+	for _, k := range s.keys {
+		folder := s.sources[k]
+		if _, ok := groups[folder]; !ok {
+			folders = append(folders, folder)
+		}
+		groups[folder] = append(groups[folder], k)
+	}
+	for _, keys := range groups {
+		sort.Strings(keys)
+	}
+	return folders, groups
+}
+
+// Render NAME="value" lines. Only shell output, which is sourced rather
+// than parsed as dotenv, gets the --bash-array declaration.
+func renderEnv(prefix string, shell bool) renderer {
+	return func(w io.Writer, s *snapshot) error {
+		writeVar := func(k string) error {
+			if desc := s.description(k); desc != "" {
+				if err := writeComment(w, desc); err != nil {
+					return err
+				}
+			}
+			v := s.env[k]
+			if !strings.HasPrefix(v, "\"") && !strings.HasPrefix(v, "'") && !strings.HasSuffix(v, "\"") && !strings.HasSuffix(v, "'") {
+				v = fmt.Sprintf("\"%s\"", v)
+			}
+			_, err := fmt.Fprintf(w, "%s%s=%s\n", prefix, k, v)
+			return err
+		}
+
+		if viper.GetBool("group-by-folder") {
+			folders, groups := s.folderGroups()
+			for i, folder := range folders {
+				if i > 0 {
+					if _, err := io.WriteString(w, "\n"); err != nil {
+						return err
+					}
+				}
+				if err := writeComment(w, folder); err != nil {
+					return err
+				}
+				for _, k := range groups[folder] {
+					if err := writeVar(k); err != nil {
+						return err
+					}
+				}
+			}
+		} else {
+			for _, k := range s.keys {
+				if err := writeVar(k); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, k := range s.unset {
+			if _, err := fmt.Fprintf(w, "unset %s\n", k); err != nil {
+				return err
+			}
+		}
+
+		if name := viper.GetString("bash-array"); shell && name != "" {
+			names := make([]string, len(s.keys))
+			for i, k := range s.keys {
+				names[i] = shellQuote(k)
+			}
+			if _, err := fmt.Fprintf(w, "%s=(%s)\n", name, strings.Join(names, " ")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Names bash accepts for a variable
+var shellNamePattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// CheckBashArray reports a --bash-array name bash can not assign, before
+// anything is fetched
+func CheckBashArray() error {
+	if name := viper.GetString("bash-array"); name != "" && !shellNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid --bash-array name %q", name)
+	}
+	return nil
+}
+
+// Single quote s for the shell unless it is a plain name
+func shellQuote(s string) string {
+	if s != "" && varNamePattern.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func jsonValue(v string) interface{} {
+	if viper.GetBool("infer-types") {
+		return inferType(v)
+	}
+	return v
+}
+
+func renderJSON(w io.Writer, s *snapshot) error {
+	var data interface{}
+	if viper.GetBool("group-by-folder") {
+		nested := map[string]map[string]interface{}{}
+		for _, k := range s.keys {
+			folder := s.sources[k]
+			if _, ok := nested[folder]; !ok {
+				nested[folder] = make(map[string]interface{})
+			}
+			nested[folder][k] = jsonValue(s.env[k])
+		}
+		data = nested
+	} else {
+		flat := make(map[string]interface{}, len(s.env))
+		for k, v := range s.env {
+			flat[k] = jsonValue(v)
+		}
+		data = flat
+	}
+
+	j, err := marshalJSON(data)
+	if err != nil {
+		return fmt.Errorf("creating JSON: %s", err)
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
+
+// Compact JSON by default, indented with --json-pretty. Map keys are sorted
+// either way.
+func marshalJSON(v interface{}) ([]byte, error) {
+	if viper.GetBool("json-pretty") {
+		indent := viper.GetInt("indent")
+		if indent < 0 {
+			indent = 0
+		}
+		return json.MarshalIndent(v, "", strings.Repeat(" ", indent))
+	}
+	return json.Marshal(v)
+}
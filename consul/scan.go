@@ -0,0 +1,60 @@
+package consul
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Prefixes of well known credential formats
+var secretPrefixes = []string{
+	"ghp_", "gho_", "ghs_", "ghu_", "github_pat_",
+	"AKIA", "ASIA",
+	"xoxb-", "xoxp-",
+	"sk_live_", "rk_live_",
+	"glpat-",
+	"-----BEGIN",
+}
+
+var tokenCharsPattern = regexp.MustCompile(`^[A-Za-z0-9+/=_-]{20,}$`)
+
+const secretEntropyThreshold = 4.0
+
+// Shannon entropy of s in bits per byte
+func entropy(s string) float64 {
+	counts := make(map[byte]int)
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var e float64
+	for _, c := range counts {
+		p := float64(c) / float64(len(s))
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// Why v looks like a secret, empty if it does not
+func secretReason(v string) string {
+	for _, prefix := range secretPrefixes {
+		if strings.HasPrefix(v, prefix) {
+			return fmt.Sprintf("starts with %q", prefix)
+		}
+	}
+	if tokenCharsPattern.MatchString(v) && entropy(v) >= secretEntropyThreshold {
+		return "high entropy"
+	}
+	return ""
+}
+
+// Warn about variables whose values look like credentials, output is not
+// changed
+func scanSecrets(keys []string, env map[string]string) {
+	for _, k := range keys {
+		if reason := secretReason(env[k]); reason != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s looks like a secret (%s) and is output in plaintext\n", k, reason)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package consul
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Read newline-delimited variable names, blank lines and # comments are ignored
+func readNames(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, scanner.Err()
+}
+
+// Keep only selected keys, returning the selected names that are missing
+func selectKeys(keys []string, env map[string]string, names []string) ([]string, []string) {
+	var selected, missing []string
+	for _, k := range keys {
+		if contains(names, k) {
+			selected = append(selected, k)
+		}
+	}
+	for _, name := range names {
+		if _, ok := env[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return selected, missing
+}
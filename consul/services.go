@@ -0,0 +1,55 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// ${service:NAME} tokens resolved with --resolve-services
+var servicePattern = regexp.MustCompile(`\$\{service:([^}]+)\}`)
+
+// Replace ${service:NAME} tokens in v with host:port of a healthy instance
+// of NAME, in the datacenter and namespace of qp. Lookups are cached per
+// fetch. Without healthy instances --service-fallback is used, or an error
+// returned when that is empty.
+func resolveServices(ctx context.Context, consul *consulapi.Client, qp queryPath, v string, cache map[string]string) (string, error) {
+	var err error
+	resolved := servicePattern.ReplaceAllStringFunc(v, func(token string) string {
+		if err != nil {
+			return token
+		}
+		name := servicePattern.FindStringSubmatch(token)[1]
+		key := qp.qualifier() + name
+		if addr, ok := cache[key]; ok {
+			return addr
+		}
+
+		entries, _, e := consul.Health().Service(name, "", true, qp.options(ctx))
+		if e != nil {
+			err = e
+			return token
+		}
+		var addr string
+		if len(entries) > 0 {
+			address := entries[0].Service.Address
+			if address == "" {
+				address = entries[0].Node.Address
+			}
+			addr = net.JoinHostPort(address, strconv.Itoa(entries[0].Service.Port))
+		} else if fallback := viper.GetString("service-fallback"); fallback != "" {
+			addr = fallback
+		} else {
+			err = fmt.Errorf("No healthy instance of service %s", name)
+			return token
+		}
+		cache[key] = addr
+		return addr
+	})
+	return resolved, err
+}
@@ -0,0 +1,84 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Health API answering with the healthy instances of each service, counting
+// the lookups
+func healthStub(t *testing.T, services map[string][]*consulapi.ServiceEntry) (*consulapi.Client, map[string]int) {
+	t.Helper()
+	lookups := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		if !r.URL.Query().Has("passing") {
+			http.Error(w, "only healthy instances expected", http.StatusBadRequest)
+			return
+		}
+		lookups[name]++
+		entries := services[name]
+		if entries == nil {
+			entries = []*consulapi.ServiceEntry{}
+		}
+		json.NewEncoder(w).Encode(entries)
+	}))
+	t.Cleanup(server.Close)
+	return consulClient(strings.TrimPrefix(server.URL, "http://")), lookups
+}
+
+func serviceEntry(node string, address string, port int) *consulapi.ServiceEntry {
+	return &consulapi.ServiceEntry{
+		Node:    &consulapi.Node{Address: node},
+		Service: &consulapi.AgentService{Address: address, Port: port},
+	}
+}
+
+func TestResolveServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		fallback string
+		want     string
+		wantErr  bool
+	}{
+		{name: "service address", value: "${service:db}", want: "10.0.0.5:5432"},
+		{name: "node address", value: "${service:cache}", want: "10.0.0.9:6379"},
+		{name: "ipv6", value: "http://${service:v6}/", want: "http://[fd00::1]:80/"},
+		{name: "several tokens", value: "postgres://${service:db}/app?replica=${service:db}", want: "postgres://10.0.0.5:5432/app?replica=10.0.0.5:5432"},
+		{name: "no tokens", value: "plain ${other:db}", want: "plain ${other:db}"},
+		{name: "no healthy instance", value: "${service:down}", wantErr: true},
+		{name: "fallback", value: "${service:down}", fallback: "localhost:5432", want: "localhost:5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("service-fallback", tt.fallback)
+			consul, lookups := healthStub(t, map[string][]*consulapi.ServiceEntry{
+				"db":    {serviceEntry("10.0.0.1", "10.0.0.5", 5432), serviceEntry("10.0.0.2", "10.0.0.6", 5432)},
+				"cache": {serviceEntry("10.0.0.9", "", 6379)},
+				"v6":    {serviceEntry("10.0.0.3", "fd00::1", 80)},
+			})
+
+			got, err := resolveServices(context.Background(), consul, parsePath("app"), tt.value, map[string]string{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveServices(%q) error %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("resolveServices(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			for name, n := range lookups {
+				if n > 1 {
+					t.Errorf("%s looked up %d times, want once", name, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package consul
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type ssmParameter struct {
+	Name  string
+	Value string
+	Type  string
+}
+
+// Render variables as a JSON array of SSM Parameter Store entries named
+// --ssm-prefix/KEY. Secret-flagged variables become SecureString.
+func renderSSM(w io.Writer, s *snapshot) error {
+	prefix := strings.TrimRight(viper.GetString("ssm-prefix"), "/")
+
+	params := make([]ssmParameter, 0, len(s.keys))
+	for _, k := range s.keys {
+		paramType := "String"
+		if s.secrets[k] {
+			paramType = "SecureString"
+		}
+		params = append(params, ssmParameter{
+			Name:  prefix + "/" + k,
+			Value: s.env[k],
+			Type:  paramType,
+		})
+	}
+
+	j, err := marshalJSON(params)
+	if err != nil {
+		return fmt.Errorf("creating SSM JSON: %s", err)
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
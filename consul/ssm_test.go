@@ -0,0 +1,43 @@
+package consul
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRenderSSM(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "", want: `[{"Name":"/DB_PASS","Value":"s3cret","Type":"SecureString"},{"Name":"/HOST","Value":"h \"q\"","Type":"String"}]`},
+		{prefix: "/app/prod", want: `[{"Name":"/app/prod/DB_PASS","Value":"s3cret","Type":"SecureString"},{"Name":"/app/prod/HOST","Value":"h \"q\"","Type":"String"}]`},
+		{prefix: "/app/prod/", want: `[{"Name":"/app/prod/DB_PASS","Value":"s3cret","Type":"SecureString"},{"Name":"/app/prod/HOST","Value":"h \"q\"","Type":"String"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("ssm-prefix", tt.prefix)
+			s := &snapshot{
+				keys:    []string{"DB_PASS", "HOST"},
+				env:     map[string]string{"DB_PASS": "s3cret", "HOST": `h "q"`},
+				secrets: map[string]bool{"DB_PASS": true},
+			}
+			var b strings.Builder
+			if err := renderSSM(&b, s); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want+"\n" {
+				t.Errorf("renderSSM = %s, want %s", b.String(), tt.want)
+			}
+		})
+	}
+
+	resetConfig(t)
+	var b strings.Builder
+	if err := renderSSM(&b, &snapshot{}); err != nil || b.String() != "[]\n" {
+		t.Errorf("renderSSM of nothing = %q, %v, want an empty array", b.String(), err)
+	}
+}
@@ -0,0 +1,76 @@
+package consul
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Identify the server, path and filter set of a run, so one --state-file
+// can serve several configurations and clusters
+func stateKey(addr string) string {
+	paths := append([]string(nil), Paths()...)
+	sort.Strings(paths)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", addr, strings.Join(paths, "\x00"))
+	for _, name := range []string{"exclude-path", "flags-filter"} {
+		fmt.Fprintf(h, "%s=%s\x00", name, strings.Join(viper.GetStringSlice(name), ","))
+	}
+	fmt.Fprintf(h, "key-separator=%s", keySeparator())
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Read the --state-file, empty when missing or corrupt so the run falls
+// back to a full fetch
+func loadState(file string) map[string]uint64 {
+	state := map[string]uint64{}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring corrupt state file %s: %s\n", file, err)
+		return map[string]uint64{}
+	}
+	return state
+}
+
+// Index stored by the previous run against addr with the same paths and
+// filters
+func stateIndex(addr string) uint64 {
+	file := viper.GetString("state-file")
+	if file == "" {
+		return 0
+	}
+	return loadState(file)[stateKey(addr)]
+}
+
+// Store the highest index seen on addr, so the next run or --poll cycle
+// only fetches later changes
+func saveState(addr string, maxIndex uint64) {
+	file := viper.GetString("state-file")
+	if file == "" {
+		return
+	}
+	state := loadState(file)
+	key := stateKey(addr)
+	if maxIndex <= state[key] {
+		return
+	}
+	state[key] = maxIndex
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(file, append(data, '\n'), 0600)
+	}
+	if err != nil {
+		fail(134, "", "Error writing state file: %s", err)
+	}
+}
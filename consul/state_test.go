@@ -0,0 +1,165 @@
+package consul
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestStateFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // state file before the run, empty for none
+		save    uint64 // index seen by the run
+		want    uint64 // index read back by the next run
+		warning string
+	}{
+		{name: "first run", save: 7, want: 7},
+		{name: "incremental run", content: "{}", save: 9, want: 9},
+		{name: "corrupt file", content: "{not json", save: 4, want: 4, warning: "Ignoring corrupt state file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			file := filepath.Join(t.TempDir(), "state.json")
+			if tt.content != "" {
+				if err := ioutil.WriteFile(file, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			viper.Set("state-file", file)
+			viper.Set("path", []string{"app"})
+
+			var index uint64
+			out := captureStderr(t, func() { index = stateIndex("consul:8500") })
+			if index != 0 {
+				t.Errorf("index %d before the first save, want 0 for a full fetch", index)
+			}
+			if !strings.Contains(out, tt.warning) {
+				t.Errorf("stderr %q, want %q", out, tt.warning)
+			}
+
+			saveState("consul:8500", tt.save)
+			if got := stateIndex("consul:8500"); got != tt.want {
+				t.Errorf("next run starts at %d, want %d", got, tt.want)
+			}
+			// An older index never moves the state back
+			saveState("consul:8500", tt.save-1)
+			if got := stateIndex("consul:8500"); got != tt.want {
+				t.Errorf("index %d after saving an older one, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateFilePerPaths(t *testing.T) {
+	resetConfig(t)
+	file := filepath.Join(t.TempDir(), "state.json")
+	viper.Set("state-file", file)
+
+	viper.Set("path", []string{"app"})
+	saveState("consul:8500", 5)
+
+	pathsOnce = sync.Once{}
+	paths = nil
+	viper.Set("path", []string{"other"})
+	if got := stateIndex("consul:8500"); got != 0 {
+		t.Errorf("other paths start at %d, want 0", got)
+	}
+	saveState("consul:8500", 3)
+
+	pathsOnce = sync.Once{}
+	paths = nil
+	viper.Set("path", []string{"app"})
+	if got := stateIndex("consul:8500"); got != 5 {
+		t.Errorf("app starts at %d, want 5", got)
+	}
+}
+
+func TestStateFileFetch(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1", "app/B", "2")
+	viper.Set("state-file", filepath.Join(t.TempDir(), "state.json"))
+	viper.Set("path", []string{"app"})
+
+	runs := []struct {
+		name   string
+		before func()
+		want   []string
+	}{
+		{name: "first run gets everything", want: []string{"A", "B"}},
+		{name: "nothing changed", want: nil},
+		{name: "only the changed key", before: func() {
+			stub.mu.Lock()
+			stub.put("app/B", "3", 0)
+			stub.mu.Unlock()
+		}, want: []string{"B"}},
+	}
+	for _, run := range runs {
+		if run.before != nil {
+			run.before()
+		}
+		f, err := fetchEnv(context.Background(), stub.client())
+		if err != nil {
+			t.Fatalf("%s: %s", run.name, err)
+		}
+		if len(f.envMap["app"]) != len(run.want) {
+			t.Errorf("%s: got %d variables, want %v", run.name, len(f.envMap["app"]), run.want)
+		}
+		for _, k := range run.want {
+			if _, ok := f.envMap["app"][k]; !ok {
+				t.Errorf("%s: %s missing", run.name, k)
+			}
+		}
+		saveState(stub.addr(), f.maxIndex)
+	}
+}
+
+// Clusters sharing a state file keep an index each
+func TestStateFilePerServer(t *testing.T) {
+	resetConfig(t)
+	viper.Set("state-file", filepath.Join(t.TempDir(), "state.json"))
+	viper.Set("path", []string{"app"})
+
+	saveState("eu:8500", 40)
+	saveState("us:8500", 3)
+	if got := stateIndex("eu:8500"); got != 40 {
+		t.Errorf("eu starts at %d, want 40", got)
+	}
+	if got := stateIndex("us:8500"); got != 3 {
+		t.Errorf("us starts at %d, want 3", got)
+	}
+}
+
+// Each --poll cycle stores its index, so the next one only renders changes
+func TestStateFilePoll(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1", "app/B", "2")
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.env")
+	viper.Set("addr", stub.addr())
+	viper.Set("state-file", filepath.Join(dir, "state.json"))
+	viper.Set("path", []string{"app"})
+	viper.Set("output-file", output)
+
+	want := []string{"A=\"1\"\nB=\"2\"\n", "B=\"3\"\n"}
+	var got []string
+	captureStderr(t, func() {
+		watch(context.Background(), func() bool {
+			data, _ := ioutil.ReadFile(output)
+			got = append(got, string(data))
+			stub.mu.Lock()
+			stub.put("app/B", "3", 0)
+			stub.mu.Unlock()
+			return len(got) < len(want)
+		})
+	})
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("cycles wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,36 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Load summary printed with --summary-format json
+type summary struct {
+	Loaded   int      `json:"loaded"`
+	Skipped  int      `json:"skipped"`
+	Filtered int      `json:"filtered"`
+	Paths    []string `json:"paths"`
+	MaxIndex uint64   `json:"max_index"`
+}
+
+// Write the summary as one JSON object to stderr, or to file when set, which
+// is created private.
+// Filtered counts keys dropped by filters other than invalid names.
+func writeSummary(file string, snap *snapshot) error {
+	s := summary{Loaded: len(snap.env), Skipped: snap.skipped, Filtered: snap.filtered, Paths: snap.paths, MaxIndex: snap.maxIndex}
+	if s.Paths == nil {
+		s.Paths = []string{}
+	}
+
+	line, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		_, err = fmt.Fprintln(os.Stderr, string(line))
+		return err
+	}
+	return writeFileAtomic(file, append(line, '\n'), 0600)
+}
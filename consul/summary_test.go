@@ -0,0 +1,53 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteSummary(t *testing.T) {
+	snap := &snapshot{
+		paths:    []string{"app", "app/db"},
+		env:      map[string]string{"A": "1", "B": "2"},
+		skipped:  1,
+		filtered: 3,
+		maxIndex: 42,
+	}
+	want := map[string]interface{}{
+		"loaded": 2.0, "skipped": 1.0, "filtered": 3.0,
+		"paths": []interface{}{"app", "app/db"}, "max_index": 42.0,
+	}
+
+	out := captureStderr(t, func() {
+		if err := writeSummary("", snap); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("decoding %q: %s", out, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summary %v, want %v", got, want)
+	}
+	if strings.Count(out, "\n") != 1 {
+		t.Errorf("summary %q, want one line", out)
+	}
+
+	file := filepath.Join(t.TempDir(), "summary.json")
+	if err := writeSummary(file, &snapshot{}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(file)
+	if string(data) != `{"loaded":0,"skipped":0,"filtered":0,"paths":[],"max_index":0}`+"\n" {
+		t.Errorf("summary file %q", data)
+	}
+	if fi, _ := os.Stat(file); fi.Mode().Perm() != 0600 {
+		t.Errorf("summary file mode %o, want 0600", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,67 @@
+package consul
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+type templateData struct {
+	Env     map[string]string            // merged variables
+	Keys    []string                     // merged variable names in output order
+	Folders map[string]map[string]string // merged variables per folder they were taken from
+	Paths   []string                     // queried paths in precedence order
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var templateFuncs = template.FuncMap{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"quote":      strconv.Quote,
+	"env":        os.Getenv,
+	"sortedKeys": sortedKeys,
+}
+
+func renderTemplate(w io.Writer, s *snapshot) error {
+	file := viper.GetString("template-file")
+	if file == "" {
+		return errors.New("--template-file is required")
+	}
+
+	text, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(filepath.Base(file)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	folders := map[string]map[string]string{}
+	for _, k := range s.keys {
+		folder := s.sources[k]
+		if _, ok := folders[folder]; !ok {
+			folders[folder] = map[string]string{}
+		}
+		folders[folder][k] = s.env[k]
+	}
+
+	return tmpl.Execute(w, templateData{Env: s.env, Keys: s.keys, Folders: folders, Paths: s.paths})
+}
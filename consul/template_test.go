@@ -0,0 +1,39 @@
+package consul
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Folders holds the merged variables only, so --value-match and selection
+// apply to templates walking folders too
+func TestRenderTemplateFolders(t *testing.T) {
+	resetConfig(t)
+	file := filepath.Join(t.TempDir(), "folders.tmpl")
+	text := `{{range $folder, $vars := .Folders}}{{range $k, $v := $vars}}{{$folder}} {{$k}}={{$v}}
+{{end}}{{end}}`
+	if err := ioutil.WriteFile(file, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("template-file", file)
+	viper.Set("path", []string{"app", "app/db"})
+	viper.Set("secret-flag", 1)
+	viper.Set("value-match", "s")
+	f := newFetched(map[string]map[string]string{
+		"app":    {"HOST": "h", "TOKEN": "s3cret"},
+		"app/db": {"USER": "u", "PASS": "pass"},
+	})
+	f.envMap["app"]["TOKEN"].Flags = 1
+
+	var b strings.Builder
+	if err := renderTemplate(&b, processEnv(f)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "app TOKEN=***\napp/db PASS=pass\n"; b.String() != want {
+		t.Errorf("renderTemplate =\n%s\nwant\n%s", b.String(), want)
+	}
+}
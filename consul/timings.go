@@ -0,0 +1,84 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type timingEntry struct {
+	Op       string  `json:"op"`
+	Path     string  `json:"path,omitempty"`
+	Ms       float64 `json:"ms"`
+	Keys     int     `json:"keys"`
+	Filtered int     `json:"filtered,omitempty"`
+}
+
+// Durations of Consul calls and key counts, printed under --timings
+type timings struct {
+	mu       sync.Mutex
+	start    time.Time
+	entries  []timingEntry
+	filtered int
+}
+
+var runTimings = newTimings()
+
+func newTimings() *timings {
+	return &timings{start: time.Now()}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (t *timings) record(op string, path string, start time.Time, keys int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, timingEntry{Op: op, Path: path, Ms: ms(time.Since(start)), Keys: keys})
+}
+
+func (t *timings) filter(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.filtered += n
+}
+
+// Print timings to stderr as aligned lines, or JSON lines with --log-format json
+func (t *timings) print() {
+	if !viper.GetBool("timings") {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := timingEntry{Op: "total", Ms: ms(time.Since(t.start)), Filtered: t.filtered}
+	for _, e := range t.entries {
+		total.Keys += e.Keys
+	}
+	entries := append(t.entries, total)
+
+	if viper.GetString("log-format") == "json" {
+		for _, e := range entries {
+			line, _ := json.Marshal(e)
+			fmt.Fprintln(os.Stderr, string(line))
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%.1fms\t%d keys", e.Op, e.Path, e.Ms, e.Keys)
+		if e.Op == "total" {
+			fmt.Fprintf(w, ", %d filtered", e.Filtered)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
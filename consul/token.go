@@ -0,0 +1,43 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/spf13/viper"
+)
+
+// Client for the configured server, with the ACL token checked up front
+// when --validate-token is set
+func connect(ctx context.Context) *consulapi.Client {
+	return connectAddr(ctx, viper.GetString("addr"))
+}
+
+func connectAddr(ctx context.Context, addr string) *consulapi.Client {
+	consul := consulClient(addr)
+	if viper.GetBool("validate-token") {
+		validateToken(ctx, consul)
+	}
+	return consul
+}
+
+// Fail fast on an invalid or expired token instead of on the first query.
+// Only the accessor is ever printed, never the secret.
+func validateToken(ctx context.Context, consul *consulapi.Client) {
+	token, _, err := consul.ACL().TokenReadSelf(queryOptions(ctx))
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(132, "", "Invalid Consul token: %s", err)
+	}
+
+	if viper.GetBool("verbose") {
+		var policies []string
+		for _, policy := range token.Policies {
+			policies = append(policies, policy.Name)
+		}
+		fmt.Fprintf(os.Stderr, "Token %q accessor %s policies: %s\n", token.Description, token.AccessorID, strings.Join(policies, ", "))
+	}
+}
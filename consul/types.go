@@ -0,0 +1,41 @@
+package consul
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+)
+
+var (
+	intPattern   = regexp.MustCompile(`^(0|-?[1-9][0-9]*)$`)
+	floatPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+([eE][-+]?[0-9]+)?$`)
+)
+
+// Largest integer a JSON consumer using float64 represents exactly
+const maxSafeInteger = 1<<53 - 1
+
+// Typed form of a string value: bool, json.Number or the string itself.
+// Leading-zero numbers (zip codes, ids) and integers beyond 2^53 stay strings.
+func inferType(v string) interface{} {
+	switch v {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if intPattern.MatchString(v) {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n <= maxSafeInteger && n >= -maxSafeInteger {
+			return json.Number(v)
+		}
+		return v
+	}
+
+	if floatPattern.MatchString(v) {
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return json.Number(v)
+		}
+	}
+
+	return v
+}
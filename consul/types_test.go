@@ -0,0 +1,77 @@
+package consul
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestInferType(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+	}{
+		{value: "true", want: true},
+		{value: "false", want: false},
+		{value: "True", want: "True"},
+		{value: "FALSE", want: "FALSE"},
+		{value: "yes", want: "yes"},
+		{value: "null", want: "null"},
+		{value: "", want: ""},
+		{value: "0", want: json.Number("0")},
+		{value: "42", want: json.Number("42")},
+		{value: "-7", want: json.Number("-7")},
+		{value: "-0", want: "-0"},
+		{value: "+5", want: "+5"},
+		{value: "0123", want: "0123"},
+		{value: " 1", want: " 1"},
+		{value: "9007199254740991", want: json.Number("9007199254740991")},
+		{value: "-9007199254740991", want: json.Number("-9007199254740991")},
+		{value: "9007199254740992", want: "9007199254740992"},
+		{value: "99999999999999999999", want: "99999999999999999999"},
+		{value: "3.14", want: json.Number("3.14")},
+		{value: "0.10", want: json.Number("0.10")},
+		{value: "-2.5e-3", want: json.Number("-2.5e-3")},
+		{value: "1e3", want: "1e3"},
+		{value: "1.", want: "1."},
+		{value: ".5", want: ".5"},
+		{value: "01.5", want: "01.5"},
+		{value: "1.5e999", want: "1.5e999"},
+		{value: "NaN", want: "NaN"},
+		{value: "Inf", want: "Inf"},
+		{value: "0x1F", want: "0x1F"},
+	}
+	for _, tt := range tests {
+		if got := inferType(tt.value); got != tt.want {
+			t.Errorf("inferType(%q) = %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRenderJSONInferTypes(t *testing.T) {
+	resetConfig(t)
+	viper.Set("infer-types", true)
+	s := &snapshot{
+		keys: []string{"DEBUG", "PORT", "RATIO", "ZIP"},
+		env:  map[string]string{"DEBUG": "true", "PORT": "8080", "RATIO": "0.5", "ZIP": "0123"},
+	}
+	var b strings.Builder
+	if err := renderJSON(&b, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(b.String()))
+	dec.UseNumber()
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("decoding %q: %s", b.String(), err)
+	}
+	want := map[string]interface{}{"DEBUG": true, "PORT": json.Number("8080"), "RATIO": json.Number("0.5"), "ZIP": "0123"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %#v, want %#v", k, got[k], v)
+		}
+	}
+}
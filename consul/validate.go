@@ -0,0 +1,78 @@
+package consul
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	pathpkg "path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Named --validate rules usable instead of a regex
+var validators = map[string]func(v string) bool{
+	"int": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"bool": func(v string) bool {
+		_, err := strconv.ParseBool(v)
+		return err == nil
+	},
+	"url": func(v string) bool {
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	},
+	"email": func(v string) bool {
+		addr, err := mail.ParseAddress(v)
+		return err == nil && addr.Address == v
+	},
+}
+
+// --validate KEY=rule: variables matching the glob KEY must match rule, a
+// named validator or a regex the whole value has to match
+type validateRule struct {
+	pattern string
+	rule    string
+	check   func(v string) bool
+}
+
+func parseValidateRules() ([]validateRule, error) {
+	var rules []validateRule
+	for _, spec := range viper.GetStringSlice("validate") {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid --validate %q, expected KEY=rule", spec)
+		}
+		if _, err := pathpkg.Match(parts[0], ""); err != nil {
+			return nil, fmt.Errorf("Invalid --validate pattern %q: %s", parts[0], err)
+		}
+
+		rule := validateRule{pattern: parts[0], rule: parts[1], check: validators[parts[1]]}
+		if rule.check == nil {
+			re, err := regexp.Compile("^(?:" + parts[1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid --validate regex %q: %s", parts[1], err)
+			}
+			rule.check = re.MatchString
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Messages for variables not matching their rules, in key order
+func validateValues(keys []string, env map[string]string, rules []validateRule) []string {
+	var invalid []string
+	for _, k := range keys {
+		for _, rule := range rules {
+			if matchesName(k, []string{rule.pattern}) && !rule.check(env[k]) {
+				invalid = append(invalid, fmt.Sprintf("%s does not match %s", k, rule.rule))
+			}
+		}
+	}
+	return invalid
+}
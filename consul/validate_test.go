@@ -0,0 +1,89 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseValidateRules(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "PORT=int"},
+		{spec: "*_URL=url"},
+		{spec: "ENV=dev|prod"},
+		{spec: "PORT", wantErr: true},
+		{spec: "=int", wantErr: true},
+		{spec: "PORT=", wantErr: true},
+		{spec: "[=int", wantErr: true},
+		{spec: "PORT=(", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("validate", []string{tt.spec})
+			if _, err := parseValidateRules(); (err != nil) != tt.wantErr {
+				t.Errorf("parseValidateRules(%q) error %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	tests := []struct {
+		rule  string
+		value string
+		valid bool
+	}{
+		{rule: "int", value: "8080", valid: true},
+		{rule: "int", value: "-1", valid: true},
+		{rule: "int", value: "80.5"},
+		{rule: "int", value: ""},
+		{rule: "bool", value: "true", valid: true},
+		{rule: "bool", value: "0", valid: true},
+		{rule: "bool", value: "yes"},
+		{rule: "url", value: "https://example.com/x", valid: true},
+		{rule: "url", value: "example.com"},
+		{rule: "url", value: "file:///tmp"},
+		{rule: "email", value: "ops@example.com", valid: true},
+		{rule: "email", value: "Ops <ops@example.com>"},
+		{rule: "email", value: "ops"},
+		// Regexes must match the whole value
+		{rule: "dev|prod", value: "prod", valid: true},
+		{rule: "dev|prod", value: "production"},
+		{rule: "[0-9]+", value: "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+"/"+tt.value, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("validate", []string{"K=" + tt.rule})
+			rules, err := parseValidateRules()
+			if err != nil {
+				t.Fatal(err)
+			}
+			invalid := validateValues([]string{"K"}, map[string]string{"K": tt.value}, rules)
+			if valid := len(invalid) == 0; valid != tt.valid {
+				t.Errorf("%q valid %v for %s, want %v", tt.value, valid, tt.rule, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateValuesGlob(t *testing.T) {
+	resetConfig(t)
+	viper.Set("validate", []string{"*_PORT=int", "DB_*=[a-z0-9]+"})
+	rules, err := parseValidateRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"DB_PORT", "API_PORT", "DB_NAME", "HOST"}
+	env := map[string]string{"DB_PORT": "X", "API_PORT": "80", "DB_NAME": "Main", "HOST": "anything"}
+
+	want := []string{"DB_PORT does not match int", "DB_PORT does not match [a-z0-9]+", "DB_NAME does not match [a-z0-9]+"}
+	if got := validateValues(keys, env, rules); !reflect.DeepEqual(got, want) {
+		t.Errorf("validateValues = %q, want %q", got, want)
+	}
+}
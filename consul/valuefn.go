@@ -0,0 +1,80 @@
+package consul
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type valueFn func(string) (string, error)
+
+var valueFns = map[string]valueFn{
+	"trim":  func(v string) (string, error) { return strings.TrimSpace(v), nil },
+	"upper": func(v string) (string, error) { return strings.ToUpper(v), nil },
+	"lower": func(v string) (string, error) { return strings.ToLower(v), nil },
+	"base64decode": func(v string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		return string(b), err
+	},
+	"base64encode": func(v string) (string, error) { return base64.StdEncoding.EncodeToString([]byte(v)), nil },
+	"urldecode":    url.QueryUnescape,
+}
+
+// --value-fn KEY=fn|fn pipeline, KEY may be a glob
+type valuePipeline struct {
+	pattern string
+	names   []string
+	fns     []valueFn
+}
+
+// Parse --value-fn specifications, unknown functions are an error
+func parseValueFns() ([]valuePipeline, error) {
+	var pipelines []valuePipeline
+	for _, spec := range viper.GetStringSlice("value-fn") {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid --value-fn %q, expected KEY=fn|fn", spec)
+		}
+		p := valuePipeline{pattern: parts[0]}
+		for _, name := range strings.Split(parts[1], "|") {
+			name = strings.TrimSpace(name)
+			fn, ok := valueFns[name]
+			if !ok {
+				return nil, fmt.Errorf("Unknown --value-fn function %q in %q", name, spec)
+			}
+			p.names = append(p.names, name)
+			p.fns = append(p.fns, fn)
+		}
+		pipelines = append(pipelines, p)
+	}
+	return pipelines, nil
+}
+
+// CheckValueFns reports invalid --value-fn specifications before anything
+// is fetched
+func CheckValueFns() error {
+	_, err := parseValueFns()
+	return err
+}
+
+// Run the pipelines matching each variable, in the order given
+func applyValueFns(keys []string, env map[string]string, pipelines []valuePipeline) error {
+	for _, k := range keys {
+		for _, p := range pipelines {
+			if !matchesName(k, []string{p.pattern}) {
+				continue
+			}
+			for i, fn := range p.fns {
+				v, err := fn(env[k])
+				if err != nil {
+					return fmt.Errorf("--value-fn %s on %s: %s", p.names[i], k, err)
+				}
+				env[k] = v
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseValueFns(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "K=trim"},
+		{spec: "*_B64=base64decode | trim|upper"},
+		{spec: "K", wantErr: true},
+		{spec: "=trim", wantErr: true},
+		{spec: "K=", wantErr: true},
+		{spec: "K=trim|reverse", wantErr: true},
+		{spec: "K=trim||upper", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("value-fn", []string{tt.spec})
+			if err := CheckValueFns(); (err != nil) != tt.wantErr {
+				t.Errorf("parseValueFns(%q) error %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyValueFns(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "single", specs: []string{"K=upper"}, value: "abc", want: "ABC"},
+		{name: "pipeline in order", specs: []string{"K=base64decode|trim|upper"}, value: " IGFiYyAK ", want: "ABC"},
+		{name: "pipelines in order", specs: []string{"K=base64encode", "K=lower"}, value: "a", want: "yq=="},
+		{name: "glob", specs: []string{"K*=lower"}, value: "ABC", want: "abc"},
+		{name: "no match", specs: []string{"OTHER=upper"}, value: "abc", want: "abc"},
+		{name: "urldecode", specs: []string{"K=urldecode"}, value: "a%20b", want: "a b"},
+		{name: "invalid base64", specs: []string{"K=base64decode"}, value: "%%%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("value-fn", tt.specs)
+			pipelines, err := parseValueFns()
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := map[string]string{"K": tt.value}
+			err = applyValueFns([]string{"K"}, env, pipelines)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyValueFns(%q) error %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && env["K"] != tt.want {
+				t.Errorf("applyValueFns(%q) = %q, want %q", tt.value, env["K"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package consul
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Render variables as a Vault KV v2 write payload, {"data": {...}}. With
+// --vault-path the variables are nested under its segments,
+// e.g. a/b gives {"data": {"a": {"b": {...}}}}.
+func renderVaultKV(w io.Writer, s *snapshot) error {
+	var inner interface{} = s.env
+	if s.env == nil {
+		inner = map[string]string{}
+	}
+
+	segments := strings.Split(strings.Trim(viper.GetString("vault-path"), "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] != "" {
+			inner = map[string]interface{}{segments[i]: inner}
+		}
+	}
+
+	j, err := marshalJSON(map[string]interface{}{"data": inner})
+	if err != nil {
+		return fmt.Errorf("creating Vault JSON: %s", err)
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
@@ -0,0 +1,68 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// The payload wraps the fetched variables, secret ones included as they are,
+// in data and under the --vault-path segments
+func TestRenderVaultKV(t *testing.T) {
+	tests := []struct {
+		vaultPath string
+		segments  []string
+	}{
+		{vaultPath: ""},
+		{vaultPath: "/team/app/", segments: []string{"team", "app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.vaultPath, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "app/HOST", "h", "app/PASS", "s3cret", "app/db/PORT", "5432")
+			stub.pairs["app/PASS"].Flags = 1
+			viper.Set("path", []string{"app", "app/db"})
+			viper.Set("secret-flag", 1)
+			viper.Set("vault-path", tt.vaultPath)
+
+			f, err := fetchEnv(context.Background(), stub.client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			if err := renderVaultKV(&b, processEnv(f)); err != nil {
+				t.Fatal(err)
+			}
+
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(b.String()), &payload); err != nil {
+				t.Fatalf("decoding %s: %s", b.String(), err)
+			}
+			if len(payload) != 1 {
+				t.Errorf("payload %v, want only data", payload)
+			}
+			inner := payload["data"]
+			for _, segment := range tt.segments {
+				m, _ := inner.(map[string]interface{})
+				if len(m) != 1 {
+					t.Fatalf("level %s holds %v, want only %s", segment, m, segment)
+				}
+				inner = m[segment]
+			}
+			want := map[string]interface{}{"HOST": "h", "PASS": "s3cret", "PORT": "5432"}
+			if !reflect.DeepEqual(inner, want) {
+				t.Errorf("variables %v, want %v", inner, want)
+			}
+		})
+	}
+
+	resetConfig(t)
+	var b strings.Builder
+	if err := renderVaultKV(&b, &snapshot{}); err != nil || b.String() != `{"data":{}}`+"\n" {
+		t.Errorf("renderVaultKV of nothing = %q, %v", b.String(), err)
+	}
+}
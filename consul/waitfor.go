@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// WaitForKey blocks until the --wait-for key exists, with blocking queries
+// on it, and fails once --wait-timeout elapses. A readiness gate for
+// config written by another process.
+func WaitForKey(ctx context.Context) {
+	key := viper.GetString("wait-for")
+	if key == "" {
+		return
+	}
+	timeout := viper.GetDuration("wait-timeout")
+	verbose := viper.GetBool("verbose")
+
+	kv := connect(ctx).KV()
+	qp := parsePath(key)
+	start := time.Now()
+
+	var index uint64
+	for {
+		q := qp.options(ctx)
+		q.WaitIndex = index
+		if timeout > 0 {
+			remaining := timeout - time.Since(start)
+			if remaining <= 0 {
+				fail(136, qp.String(), "Timed out after %s waiting for %s", timeout, qp)
+			}
+			q.WaitTime = remaining
+		}
+
+		kvPair, qm, err := kv.Get(qp.path, q)
+		if err != nil {
+			exitOnCancel(ctx)
+			fail(133, qp.String(), "%s", err)
+		}
+		if kvPair != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "%s exists after %s\n", qp, time.Since(start).Round(time.Millisecond))
+			}
+			return
+		}
+
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Waiting for %s (%s elapsed)\n", qp, time.Since(start).Round(time.Second))
+		}
+		// An index that went backwards restarts blocking from scratch
+		if qm.LastIndex < index {
+			index = 0
+		} else {
+			index = qm.LastIndex
+		}
+	}
+}
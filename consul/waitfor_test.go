@@ -0,0 +1,95 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Stub answering reads of key after a short block, writing it on the
+// appear-th read, never when appear is 0. Blocking reads without the
+// index of the previous answer are counted in unblocked.
+func waitForStub(t *testing.T, stub *consulStub, key string, appear int32, reads, unblocked *int32) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(reads, 1)
+		if n > 1 && r.URL.Query().Get("index") == "" {
+			atomic.AddInt32(unblocked, 1)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if n == appear {
+			stub.mu.Lock()
+			stub.put(key, "1", 0)
+			stub.mu.Unlock()
+		}
+		stub.serve(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestWaitForKey(t *testing.T) {
+	resetConfig(t)
+	stub := newConsulStub(t, "app/A", "1")
+	var reads, unblocked int32
+	viper.Set("addr", waitForStub(t, stub, "app/ready", 3, &reads, &unblocked))
+	viper.Set("wait-for", "app/ready")
+	viper.Set("wait-timeout", time.Minute)
+	viper.Set("verbose", true)
+
+	out := captureStderr(t, func() { WaitForKey(context.Background()) })
+	if reads != 3 {
+		t.Errorf("%d reads, want the key found on the third", reads)
+	}
+	if unblocked != 0 {
+		t.Errorf("%d reads without a wait index, want all but the first blocking", unblocked)
+	}
+	if strings.Count(out, "Waiting for app/ready") != 2 || !strings.Contains(out, "app/ready exists after") {
+		t.Errorf("stderr %q, want two waits and the key found", out)
+	}
+
+	// Without --wait-for nothing is read
+	resetConfig(t)
+	reads = 0
+	viper.Set("addr", waitForStub(t, stub, "app/ready", 0, &reads, &unblocked))
+	WaitForKey(context.Background())
+	if reads != 0 {
+		t.Errorf("%d reads without --wait-for, want none", reads)
+	}
+}
+
+// A key that never appears fails with 136 once --wait-timeout elapses.
+// Runs in a child process, as failing exits.
+func TestWaitForKeyTimeout(t *testing.T) {
+	if os.Getenv("CONSULENV_TEST_WAIT_FOR") != "" {
+		var reads, unblocked int32
+		viper.Set("addr", waitForStub(t, newConsulStub(t), "app/ready", 0, &reads, &unblocked))
+		viper.Set("wait-for", "app/ready")
+		viper.Set("wait-timeout", 50*time.Millisecond)
+		WaitForKey(context.Background())
+		os.Exit(0)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWaitForKeyTimeout$")
+	cmd.Env = append(os.Environ(), "CONSULENV_TEST_WAIT_FOR=1")
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 136 {
+		t.Fatalf("exit %v, want 136: %s", err, out)
+	}
+	if !strings.Contains(string(out), "Timed out after 50ms waiting for app/ready") {
+		t.Errorf("output %q, want the timeout", out)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("gave up after %s, want about 50ms", elapsed)
+	}
+}
@@ -0,0 +1,152 @@
+package consul
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func checksum(outs []rendered) [sha256.Size]byte {
+	h := sha256.New()
+	for _, out := range outs {
+		fmt.Fprintf(h, "%s\x00%s\x00", out.format, out.file)
+		h.Write(out.data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func runOnChange() {
+	command := viper.GetString("on-change")
+	if command == "" {
+		return
+	}
+
+	if err := runHook(command); err != nil {
+		fmt.Fprintf(os.Stderr, "on-change command failed: %s\n", err)
+	}
+}
+
+// Fetch and render repeatedly, writing outputs only when their content
+// changed since the last render. wait blocks until the next fetch and
+// returns false to stop watching. Cancelling ctx stops the watch.
+func watch(ctx context.Context, wait func() bool) {
+	consul := connect(ctx)
+
+	var last [sha256.Size]byte
+	first := true
+
+	for {
+		runTimings = newTimings()
+		f, err := fetchEnv(ctx, consul)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			snap := processEnv(f)
+			outs := renderOutputs(snap)
+			if sum := checksum(outs); first || sum != last {
+				writeOutputs(snap, outs)
+				audit(ctx, consul, snap)
+				runTimings.print()
+				if !first {
+					runOnChange()
+				}
+				last = sum
+				first = false
+			}
+			// The next cycle fetches what changed since this one
+			if len(f.failed) == 0 {
+				saveState(clientAddr(consul), f.maxIndex)
+			}
+		}
+
+		if !wait() {
+			return
+		}
+	}
+}
+
+// Poll re-fetches on a fixed interval, for networks where blocking queries
+// are cut short by proxies
+func Poll(ctx context.Context, interval time.Duration) {
+	if _, err := parseEmits(); err != nil {
+		fail(1, "", "%s", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	watch(ctx, func() bool {
+		select {
+		case <-ticker.C:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// Once retries until the first successful, non-empty render and exits, for
+// init containers that must block until config is available. Query errors
+// and empty results are retried every --retry-delay. With maxWait > 0 the
+// run fails once that much time passed without a render.
+func Once(ctx context.Context, maxWait time.Duration) {
+	if _, err := parseEmits(); err != nil {
+		fail(1, "", "%s", err)
+	}
+
+	waitCtx := ctx
+	if maxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, maxWait)
+		defer cancel()
+	}
+
+	consul := connect(waitCtx)
+	delay := viper.GetDuration("retry-delay")
+
+	var lastErr error
+	for {
+		runTimings = newTimings()
+		f, err := fetchEnv(waitCtx, consul)
+		if err == nil && !f.empty() {
+			snap := processEnv(f)
+			writeOutputs(snap, renderOutputs(snap))
+			audit(ctx, consul, snap)
+			runTimings.print()
+			failPartial(f.failed)
+			saveState(clientAddr(consul), f.maxIndex)
+			return
+		}
+		exitOnCancel(ctx)
+
+		if waitCtx.Err() == nil {
+			lastErr = err
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s, retrying in %s\n", err, delay)
+			} else {
+				fmt.Fprintf(os.Stderr, "No keys found, retrying in %s\n", delay)
+			}
+
+			select {
+			case <-time.After(delay):
+				continue
+			case <-waitCtx.Done():
+			}
+		}
+
+		exitOnCancel(ctx)
+		if lastErr != nil {
+			fail(133, "", "No successful render within %s: %s", maxWait, lastErr)
+		}
+		fail(137, "", "No successful render within %s.", maxWait)
+	}
+}
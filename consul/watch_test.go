@@ -0,0 +1,79 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// --poll-once-then-exit writes the first non-empty render and exits 0, or
+// fails once --max-wait passed. Each run happens in a child process, as
+// Once exits on failures.
+func TestOnce(t *testing.T) {
+	if dir := os.Getenv("CONSULENV_TEST_ONCE"); dir != "" {
+		var empty int32
+		fmt.Sscanf(os.Getenv("CONSULENV_TEST_EMPTY"), "%d", &empty)
+		stub := newConsulStub(t, "app/A", "1")
+		addr := emptyThenStub(t, stub, empty)
+		if empty < 0 {
+			addr = "127.0.0.1:1"
+		}
+		viper.Set("addr", addr)
+		viper.Set("path", []string{"app"})
+		viper.Set("output-file", filepath.Join(dir, "app.env"))
+		viper.Set("retry-delay", 10*time.Millisecond)
+		Once(context.Background(), 300*time.Millisecond)
+		os.Exit(0)
+	}
+
+	tests := []struct {
+		name  string
+		empty int // lists answered empty before the stub, -1 for no server
+		code  int
+		want  string
+	}{
+		{name: "first render", empty: 0, want: "A=\"1\"\n"},
+		{name: "after empty results", empty: 3, want: "A=\"1\"\n"},
+		{name: "never populated", empty: 1000, code: 137},
+		{name: "never reachable", empty: -1, code: 133},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestOnce$")
+			cmd.Env = append(os.Environ(), "CONSULENV_TEST_ONCE="+dir, fmt.Sprintf("CONSULENV_TEST_EMPTY=%d", tt.empty))
+			out, err := cmd.CombinedOutput()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+			if code != tt.code {
+				t.Fatalf("exit %d, want %d: %s", code, tt.code, out)
+			}
+			if got := strings.Count(string(out), "retrying in"); tt.code == 0 && got != tt.empty {
+				t.Errorf("%d retries, want %d: %s", got, tt.empty, out)
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, "app.env"))
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("failed run wrote %q", data)
+				}
+				return
+			}
+			if string(data) != tt.want {
+				t.Errorf("output file %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"fmt"
+	pathpkg "path"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// --when KEY=value:PATTERN rule: variables matching the glob PATTERN are
+// only output while KEY holds value
+type whenRule struct {
+	gate    string
+	value   string
+	pattern string
+}
+
+func parseWhenRules() ([]whenRule, error) {
+	var rules []whenRule
+	for _, spec := range viper.GetStringSlice("when") {
+		colon := strings.LastIndex(spec, ":")
+		eq := strings.Index(spec, "=")
+		if eq <= 0 || colon < eq || colon == len(spec)-1 {
+			return nil, fmt.Errorf("Invalid --when %q, expected KEY=value:PATTERN", spec)
+		}
+		rule := whenRule{gate: spec[:eq], value: spec[eq+1 : colon], pattern: spec[colon+1:]}
+		if _, err := pathpkg.Match(rule.pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid --when pattern %q: %s", rule.pattern, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Drop variables matched by a rule whose gate does not hold, a missing gate
+// variable never holds. Gates are evaluated before anything is dropped.
+func applyWhenRules(keys []string, env map[string]string, rules []whenRule) []string {
+	holds := make([]bool, len(rules))
+	for i, rule := range rules {
+		v, ok := env[rule.gate]
+		holds[i] = ok && v == rule.value
+	}
+
+	var kept []string
+	for _, k := range keys {
+		keep := true
+		for i, rule := range rules {
+			if ok, _ := pathpkg.Match(rule.pattern, k); ok && !holds[i] {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, k)
+		} else {
+			delete(env, k)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,68 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseWhenRules(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    whenRule
+		wantErr bool
+	}{
+		{spec: "ENV=prod:DEBUG_*", want: whenRule{gate: "ENV", value: "prod", pattern: "DEBUG_*"}},
+		{spec: "ENV=:LOCAL_*", want: whenRule{gate: "ENV", value: "", pattern: "LOCAL_*"}},
+		{spec: "URL=http://x:PROXY", want: whenRule{gate: "URL", value: "http://x", pattern: "PROXY"}},
+		{spec: "ENV=a=b:X", want: whenRule{gate: "ENV", value: "a=b", pattern: "X"}},
+		{spec: "ENVprod:X", wantErr: true},
+		{spec: "=prod:X", wantErr: true},
+		{spec: "ENV=prod:", wantErr: true},
+		{spec: "ENV:X=prod", wantErr: true},
+		{spec: "ENV=prod:[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			resetConfig(t)
+			viper.Set("when", []string{tt.spec})
+			rules, err := parseWhenRules()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWhenRules(%q) error %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && (len(rules) != 1 || rules[0] != tt.want) {
+				t.Errorf("parseWhenRules(%q) = %+v, want %+v", tt.spec, rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyWhenRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []whenRule
+		want  []string
+	}{
+		{name: "gate holds", rules: []whenRule{{gate: "ENV", value: "dev", pattern: "DEBUG_*"}}, want: []string{"ENV", "DEBUG_SQL", "HOST"}},
+		{name: "gate does not hold", rules: []whenRule{{gate: "ENV", value: "prod", pattern: "DEBUG_*"}}, want: []string{"ENV", "HOST"}},
+		{name: "missing gate", rules: []whenRule{{gate: "STAGE", value: "", pattern: "HOST"}}, want: []string{"ENV", "DEBUG_SQL"}},
+		// Dropping the gate variable itself does not affect other rules
+		{name: "gate dropped by another rule", rules: []whenRule{
+			{gate: "HOST", value: "none", pattern: "ENV"},
+			{gate: "ENV", value: "dev", pattern: "DEBUG_*"},
+		}, want: []string{"DEBUG_SQL", "HOST"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"ENV": "dev", "DEBUG_SQL": "1", "HOST": "h"}
+			got := applyWhenRules([]string{"ENV", "DEBUG_SQL", "HOST"}, env, tt.rules)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %q, want %q", got, tt.want)
+			}
+			if len(env) != len(tt.want) {
+				t.Errorf("env %v still holds dropped variables", env)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Where prints every key under the queried paths that defines variable
+// name, with its value, without merging. The key that wins the merge is
+// marked (used).
+func Where(ctx context.Context, name string, mask bool) {
+	consul := connect(ctx)
+
+	f, err := fetchEnv(ctx, consul)
+	if err != nil {
+		exitOnCancel(ctx)
+		fail(133, "", "%s", err)
+	}
+
+	var used string
+	for _, path := range Paths() {
+		if _, ok := f.envMap[normalizePath(path)][name]; ok {
+			used = normalizePath(path)
+			break
+		}
+	}
+
+	var folders []string
+	for folder, pairs := range f.envMap {
+		if _, ok := pairs[name]; ok {
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+
+	if len(folders) == 0 {
+		fail(136, "", "Variable not found: %s", name)
+	}
+
+	secretFlag := viper.GetUint64("secret-flag")
+	for _, folder := range folders {
+		kvPair := f.envMap[folder][name]
+		v := string(kvPair.Value)
+		if mask {
+			if secretFlag != 0 && kvPair.Flags == secretFlag {
+				v = maskedValue
+			}
+			v = redact(v)
+		}
+		line := []string{kvPair.Key, v}
+		if folder == used {
+			line = append(line, "(used)")
+		}
+		fmt.Println(strings.Join(line, "\t"))
+	}
+	failPartial(f.failed)
+}
@@ -0,0 +1,62 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Every path defining the variable is listed, the one winning the merge is
+// marked and secret values are masked on request
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		name string
+		mask bool
+		want string
+	}{
+		{name: "values", want: "app/db/HOST\tlocal\nshared/HOST\tshared\t(used)\nzone/HOST\tz\n"},
+		{name: "masked", mask: true, want: "app/db/HOST\t***\nshared/HOST\tshared\t(used)\nzone/HOST\tz\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetConfig(t)
+			stub := newConsulStub(t, "shared/HOST", "shared", "app/db/HOST", "local", "zone/HOST", "z", "zone/OTHER", "o")
+			stub.pairs["app/db/HOST"].Flags = 1
+			viper.Set("addr", stub.addr())
+			viper.Set("path", []string{"shared", "app/db", "zone"})
+			viper.Set("secret-flag", 1)
+
+			out := captureStdout(t, func() { Where(context.Background(), "HOST", tt.mask) })
+			if out != tt.want {
+				t.Errorf("Where =\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+// A variable in none of the paths exits with 136, in a child process
+func TestWhereNotFound(t *testing.T) {
+	if os.Getenv("CONSULENV_TEST_WHERE") != "" {
+		stub := newConsulStub(t, "app/A", "1")
+		viper.Set("addr", stub.addr())
+		viper.Set("path", []string{"app"})
+		Where(context.Background(), "MISSING", false)
+		os.Exit(0)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWhereNotFound$")
+	cmd.Env = append(os.Environ(), "CONSULENV_TEST_WHERE=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 136 {
+		t.Fatalf("exit %v, want 136: %s", err, out)
+	}
+	if !strings.Contains(string(out), "Variable not found: MISSING") {
+		t.Errorf("output %q, want the missing variable", out)
+	}
+}
@@ -0,0 +1,87 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func yamlScalar(v string) *yaml.Node {
+	tag := "!!str"
+	if viper.GetBool("infer-types") {
+		switch t := inferType(v).(type) {
+		case bool:
+			tag = "!!bool"
+		case json.Number:
+			if _, err := t.Int64(); err == nil {
+				tag = "!!int"
+			} else {
+				tag = "!!float"
+			}
+		}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v}
+}
+
+// Render variables as a flat YAML mapping, or one mapping per folder with
+// --group-by-folder. With --yaml-anchors the first occurrence of a repeated
+// value gets an anchor and later ones alias it, decoding still yields the
+// same map.
+func renderYAML(w io.Writer, s *snapshot) error {
+	anchors := viper.GetBool("yaml-anchors")
+	group := viper.GetBool("group-by-folder")
+
+	counts := map[string]int{}
+	for _, k := range s.keys {
+		counts[s.env[k]]++
+	}
+
+	keys := s.keys
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	mappings := map[string]*yaml.Node{}
+	if group {
+		folders, groups := s.folderGroups()
+		keys = nil
+		for _, folder := range folders {
+			mapping := &yaml.Node{Kind: yaml.MappingNode}
+			doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: folder}, mapping)
+			mappings[folder] = mapping
+			keys = append(keys, groups[folder]...)
+		}
+	}
+
+	first := map[string]*yaml.Node{}
+	for _, k := range keys {
+		v := s.env[k]
+
+		var node *yaml.Node
+		if anchors && v != "" && counts[v] > 1 {
+			if anchor, ok := first[v]; ok {
+				node = &yaml.Node{Kind: yaml.AliasNode, Alias: anchor, Value: anchor.Anchor}
+			} else {
+				node = yamlScalar(v)
+				node.Anchor = fmt.Sprintf("v%d", len(first)+1)
+				first[v] = node
+			}
+		} else {
+			node = yamlScalar(v)
+		}
+
+		parent := doc
+		if group {
+			parent = mappings[s.sources[k]]
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k, HeadComment: s.description(k)}
+		parent.Content = append(parent.Content, key, node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("creating YAML: %s", err)
+	}
+	return enc.Close()
+}
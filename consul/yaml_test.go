@@ -0,0 +1,62 @@
+package consul
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderYAMLAnchors(t *testing.T) {
+	resetConfig(t)
+	viper.Set("yaml-anchors", true)
+	endpoint := "https://shared.example.com:8443/api/v1"
+	s := &snapshot{
+		keys: []string{"API", "BACKUP_API", "COUNT", "EMPTY", "OTHER_EMPTY", "SINGLE", "TRUTH", "ZIP"},
+		env: map[string]string{
+			"API": endpoint, "BACKUP_API": endpoint, "COUNT": "12", "EMPTY": "", "OTHER_EMPTY": "",
+			"SINGLE": "once", "TRUTH": "true", "ZIP": "0123",
+		},
+	}
+	var b strings.Builder
+	if err := renderYAML(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(b.String(), endpoint) != 1 || !strings.Contains(b.String(), "&v1") || !strings.Contains(b.String(), "*v1") {
+		t.Errorf("renderYAML = %q, want the endpoint once with an alias", b.String())
+	}
+
+	var got map[string]string
+	if err := yaml.Unmarshal([]byte(b.String()), &got); err != nil {
+		t.Fatalf("decoding %q: %s", b.String(), err)
+	}
+	if !reflect.DeepEqual(got, s.env) {
+		t.Errorf("decoded %v, want %v", got, s.env)
+	}
+}
+
+func TestRenderYAMLAnchorsByFolder(t *testing.T) {
+	resetConfig(t)
+	viper.Set("yaml-anchors", true)
+	viper.Set("group-by-folder", true)
+	s := &snapshot{
+		keys:    []string{"A", "B", "C"},
+		env:     map[string]string{"A": "same", "B": "same", "C": "other"},
+		sources: map[string]string{"A": "app", "B": "app/db", "C": "app/db"},
+	}
+	var b strings.Builder
+	if err := renderYAML(&b, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]map[string]string
+	if err := yaml.Unmarshal([]byte(b.String()), &got); err != nil {
+		t.Fatalf("decoding %q: %s", b.String(), err)
+	}
+	want := map[string]map[string]string{"app": {"A": "same"}, "app/db": {"B": "same", "C": "other"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+}